@@ -14,13 +14,16 @@ func (b *Board) Apply(m Move) func() {
 // Applies a move to the board, and returns move application information and a function that can be used to unapply it.
 // This function assumes that the given move is valid (i.e., is in the set of moves found by GenerateLegalMoves()).
 // If the move is not valid, this function has undefined behavior.
+// Moves without flags (such as those from ParseMove) are accepted, but are slower to apply.
 func (b *Board) Apply2(m Move) *MoveApplication {
 	var moveApplication MoveApplication
+	if m.MovedPiece() == Nothing {
+		m = b.FlagMove(m)
+	}
 	
 	// Configure data about which pieces move
 	var ourBitboardPtr, oppBitboardPtr *Bitboards
-	var epDelta int8                                // add this to the e.p. square to find the captured pawn
-	var oppStartingRankBb, ourStartingRankBb uint64 // the starting rank of out opponent's major pieces
+	var epDelta int8 // add this to the e.p. square to find the captured pawn
 	// the constant that represents the index into pieceSquareZobristC for the pawn of our color
 	var ourPiecesPawnZobristIndex int
 	var oppPiecesPawnZobristIndex int
@@ -28,54 +31,40 @@ func (b *Board) Apply2(m Move) *MoveApplication {
 		ourBitboardPtr = &(b.White)
 		oppBitboardPtr = &(b.Black)
 		epDelta = -8
-		oppStartingRankBb = onlyRank[7]
-		ourStartingRankBb = onlyRank[0]
 		ourPiecesPawnZobristIndex = 0
 		oppPiecesPawnZobristIndex = 6
 	} else {
 		ourBitboardPtr = &(b.Black)
 		oppBitboardPtr = &(b.White)
 		epDelta = 8
-		oppStartingRankBb = onlyRank[0]
-		ourStartingRankBb = onlyRank[7]
 		b.Fullmoveno++ // increment after black's move
 		ourPiecesPawnZobristIndex = 6
 		oppPiecesPawnZobristIndex = 0
 	}
-	fromBitboard := (uint64(1) << m.From())
-	toBitboard := (uint64(1) << m.To())
-	pieceType, pieceTypeBitboard := determinePieceType(b, ourBitboardPtr, fromBitboard, m.From())
+	pieceType := m.MovedPiece()
+	pieceTypeBitboard := ourBitboardPtr.pieceBitboard(pieceType)
 
 	moveApplication.FromPieceType = pieceType
 	moveApplication.CapturedPieceType = Nothing
 	moveApplication.IsCastling = false
-	
-	castleStatus := 0
-	var oldRookLoc, newRookLoc uint8
+
+	if m.IsCastle() {
+		return b.applyCastle(m, m.To() > m.From(), ourBitboardPtr, ourPiecesPawnZobristIndex, &moveApplication)
+	}
+
 	var flippedKsCastle, flippedQsCastle, flippedOppKsCastle, flippedOppQsCastle bool
 
 	// If it is any kind of capture or pawn move, reset halfmove clock.
 	resetHalfmoveClockFrom := -1
-	if IsCapture(m, b) || pieceType == Pawn { 
+	if m.IsCapture() || pieceType == Pawn {
 		resetHalfmoveClockFrom = int(b.Halfmoveclock)
 		b.Halfmoveclock = 0 // reset halfmove clock
 	} else {
 		b.Halfmoveclock++
 	}
 
-	// King moves strip castling rights
+	// King moves always strip castling rights
 	if pieceType == King {
-		// TODO(dylhunn): do this without a branch
-		if m.To()-m.From() == 2 { // castle short
-			castleStatus = 1
-			oldRookLoc = m.To() + 1
-			newRookLoc = m.To() - 1
-		} else if int(m.To())-int(m.From()) == -2 { // castle long
-			castleStatus = -1
-			oldRookLoc = m.To() - 2
-			newRookLoc = m.To() + 1
-		}
-		// King moves always strip castling rights
 		if b.canCastleKingside() {
 			b.flipKingsideCastle()
 			flippedKsCastle = true
@@ -88,34 +77,19 @@ func (b *Board) Apply2(m Move) *MoveApplication {
 
 	// Rook moves strip castling rights
 	if pieceType == Rook {
-		if b.canCastleKingside() && (fromBitboard&onlyFile[7] != 0) &&
-			fromBitboard&ourStartingRankBb != 0 { // king's rook
+		if b.canCastleKingside() && m.From() == b.castleRookSquare(b.Wtomove, true) { // king's rook
 			flippedKsCastle = true
 			b.flipKingsideCastle()
-		} else if b.canCastleQueenside() && (fromBitboard&onlyFile[0] != 0) &&
-			fromBitboard&ourStartingRankBb != 0 { // queen's rook
+		} else if b.canCastleQueenside() && m.From() == b.castleRookSquare(b.Wtomove, false) { // queen's rook
 			flippedQsCastle = true
 			b.flipQueensideCastle()
 		}
 	}
 
-	// Apply the castling rook movement
-	if castleStatus != 0 {
-		b.movePiece(Rook, Rook, oldRookLoc, newRookLoc, &ourBitboardPtr.Rooks, &ourBitboardPtr.Rooks, &ourBitboardPtr.All) // ??? Flumoxed
-		// Update rook location in hash
-		// (Rook - 1) assumes that "Nothing" precedes "Rook" in the Piece constants list
-		b.hash ^= pieceSquareZobristC[ourPiecesPawnZobristIndex+(Rook-1)][oldRookLoc]
-		b.hash ^= pieceSquareZobristC[ourPiecesPawnZobristIndex+(Rook-1)][newRookLoc]
-
-		moveApplication.IsCastling = true
-		moveApplication.RookCastleFrom = oldRookLoc
-		moveApplication.RookCastleTo = newRookLoc
-	}
-
 	// Is this an e.p. capture? Strip the opponent pawn and reset the e.p. square
 	oldEpCaptureSquare := b.enpassant
 	var actuallyPerformedEpCapture bool = false
-	if pieceType == Pawn && m.To() == oldEpCaptureSquare && oldEpCaptureSquare != 0 {
+	if m.IsEnPassant() {
 		actuallyPerformedEpCapture = true
 		epOpponentPawnLocation := uint8(int8(oldEpCaptureSquare) + epDelta)
 		b.removePiece(Pawn, epOpponentPawnLocation, &oppBitboardPtr.Pawns, &oppBitboardPtr.All)
@@ -126,7 +100,7 @@ func (b *Board) Apply2(m Move) *MoveApplication {
 		moveApplication.CaptureLocation = epOpponentPawnLocation
 	}
 	// Update the en passant square
-	if pieceType == Pawn && (int8(m.To())+2*epDelta == int8(m.From())) { // pawn double push
+	if m.IsDoublePush() {
 		b.enpassant = uint8(int8(m.To()) + epDelta)
 	} else {
 		b.enpassant = 0
@@ -156,8 +130,11 @@ func (b *Board) Apply2(m Move) *MoveApplication {
 	moveApplication.ToPieceType = promotedToPieceType
 
 	// Apply the move - remove the captured piece first so that we don't overwrite the moved piece
-	capturedPieceType, capturedBitboard := determinePieceType(b, oppBitboardPtr, toBitboard, m.To())
-	if capturedPieceType != Nothing {   // This does not account for e.p. captures
+	var capturedPieceType Piece = Nothing // excluding e.p. captures
+	var capturedBitboard *uint64
+	if m.IsCapture() && !m.IsEnPassant() {
+		capturedPieceType = m.CapturedPiece()
+		capturedBitboard = oppBitboardPtr.pieceBitboard(capturedPieceType)
 		b.removePiece(capturedPieceType, m.To(), capturedBitboard, &oppBitboardPtr.All)
 		b.hash ^= pieceSquareZobristC[oppPiecesPawnZobristIndex+(int(capturedPieceType)-1)][m.To()] // remove the captured piece from the hash - TODO (RPJ) wrong capture location for en-passant?
 		
@@ -170,10 +147,10 @@ func (b *Board) Apply2(m Move) *MoveApplication {
 
 	// If a rook was captured, it strips castling rights
 	if capturedPieceType == Rook {
-		if m.To()%8 == 7 && toBitboard&oppStartingRankBb != 0 && b.oppCanCastleKingside() { // captured king rook
+		if m.To() == b.castleRookSquare(!b.Wtomove, true) && b.oppCanCastleKingside() { // captured king rook
 			b.flipOppKingsideCastle()
 			flippedOppKsCastle = true
-		} else if m.To()%8 == 0 && toBitboard&oppStartingRankBb != 0 && b.oppCanCastleQueenside() { // queen rooks
+		} else if m.To() == b.castleRookSquare(!b.Wtomove, false) && b.oppCanCastleQueenside() { // queen rooks
 			b.flipOppQueensideCastle()
 			flippedOppQsCastle = true
 		}
@@ -183,8 +160,8 @@ func (b *Board) Apply2(m Move) *MoveApplication {
 	b.Wtomove = !b.Wtomove
 
 	// remove the old en passant square from the hash, and add the new one
-	b.hash ^= uint64(oldEpCaptureSquare)
-	b.hash ^= uint64(b.enpassant)
+	b.hash ^= enpassantZobrist(oldEpCaptureSquare)
+	b.hash ^= enpassantZobrist(b.enpassant)
 
 	// Generate the unapply function (closure)
 	moveApplication.Unapply = func() {
@@ -211,17 +188,9 @@ func (b *Board) Apply2(m Move) *MoveApplication {
 			b.hash ^= pieceSquareZobristC[oppPiecesPawnZobristIndex+(int(capturedPieceType)-1)][m.To()]
 		}
 
-		// Restore rooks from castling move
-		if castleStatus != 0 {
-			b.movePiece(Rook, Rook, newRookLoc, oldRookLoc, &ourBitboardPtr.Rooks, &ourBitboardPtr.Rooks, &ourBitboardPtr.All) // ??? Flumoxed
-			// Revert castling rook move
-			b.hash ^= pieceSquareZobristC[ourPiecesPawnZobristIndex+(Rook-1)][oldRookLoc]
-			b.hash ^= pieceSquareZobristC[ourPiecesPawnZobristIndex+(Rook-1)][newRookLoc]
-		}
-
 		// Unapply en-passant square change, and capture if necessary
-		b.hash ^= uint64(b.enpassant)        // undo the new en passant square from the hash
-		b.hash ^= uint64(oldEpCaptureSquare) // restore the old one to the hash
+		b.hash ^= enpassantZobrist(b.enpassant)        // undo the new en passant square from the hash
+		b.hash ^= enpassantZobrist(oldEpCaptureSquare) // restore the old one to the hash
 		b.enpassant = oldEpCaptureSquare
 		if actuallyPerformedEpCapture {
 			epOpponentPawnLocation := uint8(int8(oldEpCaptureSquare) + epDelta)
@@ -254,6 +223,254 @@ func (b *Board) Apply2(m Move) *MoveApplication {
 	return &moveApplication
 }
 
+// Applies a castling move, encoded either as the king moving two squares or (in Chess960)
+// as the king capturing its own rook. Called from Apply2 after the move counter is updated.
+func (b *Board) applyCastle(m Move, kingside bool, ourBitboardPtr *Bitboards, ourPiecesPawnZobristIndex int, moveApplication *MoveApplication) *MoveApplication {
+	kingFrom := m.From()
+	rookFrom, kingTo, rookTo := b.castlingSquares(kingFrom, kingside)
+	// (King - 1) assumes that "Nothing" precedes the pieces in the Piece constants list
+	kingZobrist := &pieceSquareZobristC[ourPiecesPawnZobristIndex+(King-1)]
+	rookZobrist := &pieceSquareZobristC[ourPiecesPawnZobristIndex+(Rook-1)]
+	b.Halfmoveclock++
+
+	// Castling always strips both castling rights
+	var flippedKsCastle, flippedQsCastle bool
+	if b.canCastleKingside() {
+		b.flipKingsideCastle()
+		flippedKsCastle = true
+	}
+	if b.canCastleQueenside() {
+		b.flipQueensideCastle()
+		flippedQsCastle = true
+	}
+
+	b.moveCastlingPieces(ourBitboardPtr, kingFrom, rookFrom, kingTo, rookTo)
+	b.hash ^= kingZobrist[kingFrom] ^ kingZobrist[kingTo] ^ rookZobrist[rookFrom] ^ rookZobrist[rookTo]
+
+	oldEpCaptureSquare := b.enpassant
+	b.enpassant = 0
+	b.hash ^= enpassantZobrist(oldEpCaptureSquare)
+	b.hash ^= whiteToMoveZobristC
+	b.Wtomove = !b.Wtomove
+
+	moveApplication.ToPieceType = King
+	moveApplication.IsCastling = true
+	moveApplication.RookCastleFrom = rookFrom
+	moveApplication.RookCastleTo = rookTo
+	moveApplication.Unapply = func() {
+		b.hash ^= whiteToMoveZobristC
+		b.Wtomove = !b.Wtomove
+		b.Halfmoveclock--
+
+		b.moveCastlingPieces(ourBitboardPtr, kingTo, rookTo, kingFrom, rookFrom)
+		b.hash ^= kingZobrist[kingFrom] ^ kingZobrist[kingTo] ^ rookZobrist[rookFrom] ^ rookZobrist[rookTo]
+
+		b.hash ^= enpassantZobrist(oldEpCaptureSquare)
+		b.enpassant = oldEpCaptureSquare
+		if !b.Wtomove {
+			b.Fullmoveno-- // decrement after undoing black's move
+		}
+		if flippedKsCastle {
+			b.flipKingsideCastle()
+		}
+		if flippedQsCastle {
+			b.flipQueensideCastle()
+		}
+	}
+	return moveApplication
+}
+
+// Returns the starting square of the castling rook, and the destination squares of the
+// king and rook, for castling by the side to move.
+func (b *Board) castlingSquares(kingFrom uint8, kingside bool) (rookFrom, kingTo, rookTo uint8) {
+	rookFrom = b.castleRookSquare(b.Wtomove, kingside)
+	backRank := kingFrom &^ 7
+	if kingside {
+		return rookFrom, backRank + 6, backRank + 5
+	}
+	return rookFrom, backRank + 2, backRank + 3
+}
+
+// Moves the king and rook when castling (or uncastling). Lifts both pieces before
+// placing them, since in Chess960 their squares may overlap.
+func (b *Board) moveCastlingPieces(bb *Bitboards, kingFrom, rookFrom, kingTo, rookTo uint8) {
+	b.removePiece(King, kingFrom, &bb.Kings, &bb.All)
+	b.removePiece(Rook, rookFrom, &bb.Rooks, &bb.All)
+	b.addPiece(King, kingTo, &bb.Kings, &bb.All)
+	b.addPiece(Rook, rookTo, &bb.Rooks, &bb.All)
+}
+
+// The state that MakeMove saves, so that UnmakeMove can restore the board.
+// An UndoInfo can be reused once its move has been unmade.
+type UndoInfo struct {
+	CapturedPiece Piece // Nothing if the move is not a capture
+	castlerights  uint8
+	enpassant     uint8
+	halfmoveclock uint8
+	hash          uint64
+	castle        bool // whether the move is castling
+	kingside      bool // only valid if castle
+}
+
+// Applies a move to the board, saving the state needed to unapply it in undo.
+// Unlike Apply, this does not allocate.
+// This function assumes that the given move is valid (i.e., is in the set of moves found by GenerateLegalMoves()).
+// If the move is not valid, this function has undefined behavior.
+// Moves without flags (such as those from ParseMove) are accepted, but are slower to apply.
+func (b *Board) MakeMove(m Move, undo *UndoInfo) {
+	if m.MovedPiece() == Nothing {
+		m = b.FlagMove(m)
+	}
+	*undo = UndoInfo{CapturedPiece: Nothing, castlerights: b.castlerights, enpassant: b.enpassant,
+		halfmoveclock: b.Halfmoveclock, hash: b.hash}
+
+	var ourBitboardPtr, oppBitboardPtr *Bitboards
+	var epDelta int8 // add this to the e.p. square to find the captured pawn
+	var ourPiecesPawnZobristIndex, oppPiecesPawnZobristIndex int
+	if b.Wtomove {
+		ourBitboardPtr, oppBitboardPtr = &b.White, &b.Black
+		epDelta = -8
+		ourPiecesPawnZobristIndex, oppPiecesPawnZobristIndex = 0, 6
+	} else {
+		ourBitboardPtr, oppBitboardPtr = &b.Black, &b.White
+		epDelta = 8
+		ourPiecesPawnZobristIndex, oppPiecesPawnZobristIndex = 6, 0
+		b.Fullmoveno++ // increment after black's move
+	}
+	from, to := m.From(), m.To()
+	pieceType := m.MovedPiece()
+	oldEpCaptureSquare := b.enpassant
+
+	if m.IsCastle() {
+		kingside := to > from
+		undo.castle, undo.kingside = true, kingside
+		rookFrom, kingTo, rookTo := b.castlingSquares(from, kingside)
+		if b.canCastleKingside() {
+			b.flipKingsideCastle()
+		}
+		if b.canCastleQueenside() {
+			b.flipQueensideCastle()
+		}
+		b.moveCastlingPieces(ourBitboardPtr, from, rookFrom, kingTo, rookTo)
+		kingZobrist := &pieceSquareZobristC[ourPiecesPawnZobristIndex+(King-1)]
+		rookZobrist := &pieceSquareZobristC[ourPiecesPawnZobristIndex+(Rook-1)]
+		b.hash ^= kingZobrist[from] ^ kingZobrist[kingTo] ^ rookZobrist[rookFrom] ^ rookZobrist[rookTo]
+		b.Halfmoveclock++
+		b.enpassant = 0
+		b.hash ^= enpassantZobrist(oldEpCaptureSquare)
+		b.hash ^= whiteToMoveZobristC
+		b.Wtomove = !b.Wtomove
+		return
+	}
+
+	capturedPieceType := m.CapturedPiece()
+	if m.IsCapture() || pieceType == Pawn {
+		b.Halfmoveclock = 0
+	} else {
+		b.Halfmoveclock++
+	}
+
+	// King and rook moves strip castling rights
+	if pieceType == King {
+		if b.canCastleKingside() {
+			b.flipKingsideCastle()
+		}
+		if b.canCastleQueenside() {
+			b.flipQueensideCastle()
+		}
+	} else if pieceType == Rook {
+		if b.canCastleKingside() && from == b.castleRookSquare(b.Wtomove, true) {
+			b.flipKingsideCastle()
+		} else if b.canCastleQueenside() && from == b.castleRookSquare(b.Wtomove, false) {
+			b.flipQueensideCastle()
+		}
+	}
+
+	// Remove the captured piece
+	if m.IsEnPassant() {
+		epOpponentPawnLocation := uint8(int8(oldEpCaptureSquare) + epDelta)
+		b.removePiece(Pawn, epOpponentPawnLocation, &oppBitboardPtr.Pawns, &oppBitboardPtr.All)
+		b.hash ^= pieceSquareZobristC[oppPiecesPawnZobristIndex][epOpponentPawnLocation]
+		undo.CapturedPiece = Pawn
+	} else if capturedPieceType != Nothing {
+		b.removePiece(capturedPieceType, to, oppBitboardPtr.pieceBitboard(capturedPieceType), &oppBitboardPtr.All)
+		b.hash ^= pieceSquareZobristC[oppPiecesPawnZobristIndex+(int(capturedPieceType)-1)][to]
+		undo.CapturedPiece = capturedPieceType
+		// If a rook was captured, it strips castling rights
+		if capturedPieceType == Rook {
+			if to == b.castleRookSquare(!b.Wtomove, true) && b.oppCanCastleKingside() {
+				b.flipOppKingsideCastle()
+			} else if to == b.castleRookSquare(!b.Wtomove, false) && b.oppCanCastleQueenside() {
+				b.flipOppQueensideCastle()
+			}
+		}
+	}
+
+	// Move the piece, promoting it if necessary
+	promotedToPieceType := pieceType
+	if m.Promote() != Nothing {
+		promotedToPieceType = m.Promote()
+	}
+	b.movePiece(pieceType, promotedToPieceType, from, to, ourBitboardPtr.pieceBitboard(pieceType),
+		ourBitboardPtr.pieceBitboard(promotedToPieceType), &ourBitboardPtr.All)
+	b.hash ^= pieceSquareZobristC[(int(pieceType)-1)+ourPiecesPawnZobristIndex][from]
+	b.hash ^= pieceSquareZobristC[(int(promotedToPieceType)-1)+ourPiecesPawnZobristIndex][to]
+
+	// Update the en passant square
+	if m.IsDoublePush() {
+		b.enpassant = uint8(int8(to) + epDelta)
+	} else {
+		b.enpassant = 0
+	}
+	b.hash ^= enpassantZobrist(oldEpCaptureSquare)
+	b.hash ^= enpassantZobrist(b.enpassant)
+
+	b.hash ^= whiteToMoveZobristC
+	b.Wtomove = !b.Wtomove
+}
+
+// Unapplies a move applied by MakeMove, restoring the state saved in undo.
+// The move must be the last one made on the board. This does not allocate.
+func (b *Board) UnmakeMove(m Move, undo *UndoInfo) {
+	b.Wtomove = !b.Wtomove
+	var ourBitboardPtr, oppBitboardPtr *Bitboards
+	var epDelta int8
+	if b.Wtomove {
+		ourBitboardPtr, oppBitboardPtr = &b.White, &b.Black
+		epDelta = -8
+	} else {
+		ourBitboardPtr, oppBitboardPtr = &b.Black, &b.White
+		epDelta = 8
+		b.Fullmoveno-- // decrement after undoing black's move
+	}
+	from, to := m.From(), m.To()
+
+	if undo.castle {
+		rookFrom, kingTo, rookTo := b.castlingSquares(from, undo.kingside)
+		b.moveCastlingPieces(ourBitboardPtr, kingTo, rookTo, from, rookFrom)
+	} else {
+		promotedToPieceType := b.pieces[to]
+		pieceType := promotedToPieceType
+		if m.Promote() != Nothing {
+			pieceType = Pawn
+		}
+		b.movePiece(promotedToPieceType, pieceType, to, from, ourBitboardPtr.pieceBitboard(promotedToPieceType),
+			ourBitboardPtr.pieceBitboard(pieceType), &ourBitboardPtr.All)
+		if captured := undo.CapturedPiece; captured != Nothing {
+			captureLocation := to
+			if pieceType == Pawn && to == undo.enpassant && undo.enpassant != 0 {
+				captureLocation = uint8(int8(to) + epDelta)
+			}
+			b.addPiece(captured, captureLocation, oppBitboardPtr.pieceBitboard(captured), &oppBitboardPtr.All)
+		}
+	}
+
+	b.castlerights = undo.castlerights
+	b.enpassant = undo.enpassant
+	b.Halfmoveclock = undo.halfmoveclock
+	b.hash = undo.hash
+}
+
 // Applies a null move to the board, and returns a function that can be used to unapply it.
 // A null move is just that - the current player skips his move.
 // Used for Null Move Heuristic in the search engine.
@@ -266,7 +483,7 @@ func (b *Board) ApplyNullMove() func() {
 	b.enpassant = 0
 
 	// remove the old en passant square from the hash, and add the new one
-	b.hash ^= uint64(oldEpCaptureSquare)
+	b.hash ^= enpassantZobrist(oldEpCaptureSquare)
 
 	// flip the side to move in the hash
 	b.hash ^= whiteToMoveZobristC
@@ -279,7 +496,7 @@ func (b *Board) ApplyNullMove() func() {
 		b.Wtomove = !b.Wtomove
 
 		// Unapply en-passant square change
-		b.hash ^= uint64(oldEpCaptureSquare) // restore the old one to the hash
+		b.hash ^= enpassantZobrist(oldEpCaptureSquare) // restore the old one to the hash
 		b.enpassant = oldEpCaptureSquare
 	}
 	
@@ -86,6 +86,12 @@ func TestApplyUnapply(t *testing.T) {
 		"r3k2r/Pppp1ppp/1b3nbN/nPB5/2P1P3/qB3N2/P2P2PP/r2Q1RK1 b kq - 0 0": parseMove("a1a2"),
 		// Moving toward a forced mate
 		"5k2/5p2/5P2/8/8/2r5/2rR2K1/4B2R w - - 0 1": parseMove("h1h8"),
+		// Chess960 castling, encoded as the king capturing its own rook
+		"1r2k1r1/8/8/8/8/8/8/1R2K1R1 w KQkq - 0 1": parseMove("e1g1"),
+		"1r2k1r1/8/8/8/8/8/8/1R2K1R1 b KQkq - 0 1": parseMove("e8b8"),
+		// Chess960 castling where the king moves toward the rook, or stays put
+		"k7/8/8/8/8/8/8/RK5R w KQ - 0 1": parseMove("b1a1"),
+		"k7/8/8/8/8/8/8/R5KR w KQ - 0 1": parseMove("g1h1"),
 	}
 	results := map[string]string{
 		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 0":                "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 0",
@@ -108,6 +114,10 @@ func TestApplyUnapply(t *testing.T) {
 		"r3k2r/Pppp1ppp/1b3nbN/nPB5/B1P1P3/q4N2/P2P2PP/r2Q1RK1 w kq - 0 0":        "r3k2r/Pppp1ppp/1b3nbN/nPB5/B1P1P3/q4N2/P2P2PP/Q4RK1 b kq - 0 0",
 		"r3k2r/Pppp1ppp/1b3nbN/nPB5/2P1P3/qB3N2/P2P2PP/r2Q1RK1 b kq - 0 0":        "r3k2r/Pppp1ppp/1b3nbN/nPB5/2P1P3/qB3N2/r2P2PP/3Q1RK1 w kq - 0 1",
 		"5k2/5p2/5P2/8/8/2r5/2rR2K1/4B2R w - - 0 1":                               "5k1R/5p2/5P2/8/8/2r5/2rR2K1/4B3 b - - 1 1",
+		"1r2k1r1/8/8/8/8/8/8/1R2K1R1 w KQkq - 0 1":                                "1r2k1r1/8/8/8/8/8/8/1R3RK1 b kq - 1 1",
+		"1r2k1r1/8/8/8/8/8/8/1R2K1R1 b KQkq - 0 1":                                "2kr2r1/8/8/8/8/8/8/1R2K1R1 w KQ - 1 2",
+		"k7/8/8/8/8/8/8/RK5R w KQ - 0 1":                                          "k7/8/8/8/8/8/8/2KR3R b - - 1 1",
+		"k7/8/8/8/8/8/8/R5KR w KQ - 0 1":                                          "k7/8/8/8/8/8/8/R4RK1 b - - 1 1",
 	}
 	for k, v := range movesMap {
 		b := parseFenAndValidate(t, k)
@@ -167,3 +177,66 @@ func TestApplyUnapply(t *testing.T) {
 		}*/
 	}
 }
+
+// Counts positions like Perft, using MakeMove and UnmakeMove, and checks that they
+// agree with Apply and its unapply function.
+func perftMakeMove(t *testing.T, b *Board, n int) int64 {
+	if n == 0 {
+		return 1
+	}
+	var count int64
+	var undo UndoInfo
+	for _, m := range b.GenerateLegalMoves() {
+		before := *b
+		unapply := b.Apply(m)
+		applied := *b
+		unapply()
+		unapply = b.Apply(m.Base())
+		if *b != applied {
+			t.Fatal("Apply disagrees for", m.String(), "without flags in", before.ToFen())
+		}
+		unapply()
+		b.MakeMove(m, &undo)
+		if *b != applied {
+			t.Fatal("MakeMove and Apply disagree for", m.String(), "in", before.ToFen())
+		}
+		count += perftMakeMove(t, b, n-1)
+		b.UnmakeMove(m, &undo)
+		if *b != before {
+			t.Fatal("UnmakeMove did not restore the board for", m.String(), "in", before.ToFen())
+		}
+	}
+	return count
+}
+
+func TestMakeUnmakeMove(t *testing.T) {
+	positions := map[string]map[int]int64{
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0": {3: 97862},
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 0":                            {4: 43238},
+		"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N b - - 0 1":                              {3: 9483},
+		"bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9":    {3: 12189},
+	}
+	for fen, solutions := range positions {
+		for depth, expected := range solutions {
+			b := parseFenAndValidate(t, fen)
+			if result := perftMakeMove(t, &b, depth); result != expected {
+				t.Error("Perft with MakeMove gives", result, "instead of", expected, "for", fen)
+			}
+		}
+	}
+}
+
+func TestMakeMoveDoesNotAllocate(t *testing.T) {
+	b := parseFenAndValidate(t, "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0")
+	moves := b.GenerateLegalMoves()
+	var undo UndoInfo
+	allocs := testing.AllocsPerRun(10, func() {
+		for _, m := range moves {
+			b.MakeMove(m, &undo)
+			b.UnmakeMove(m, &undo)
+		}
+	})
+	if allocs != 0 {
+		t.Error("MakeMove and UnmakeMove allocated", allocs, "times")
+	}
+}
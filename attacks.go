@@ -0,0 +1,176 @@
+package dragontoothmg
+
+import (
+	"math/bits"
+)
+
+// Returns the squares attacked by a knight on the given square.
+func KnightAttacks(sq Square) uint64 {
+	return knightMasks[sq]
+}
+
+// Returns the squares attacked by a king on the given square.
+func KingAttacks(sq Square) uint64 {
+	return kingMasks[sq]
+}
+
+// Returns the squares attacked by a pawn of the given color on the given square.
+func PawnAttacks(sq Square, white bool) uint64 {
+	// The squares attacked by a white pawn are those from which black pawns attack it.
+	return pawnAttackerMask(white, uint8(sq))
+}
+
+// Returns the pieces of both colors that attack a square, given a hypothetical occupancy.
+// Sliders are blocked by the pieces in occupancy, so x-ray attackers can be found by
+// removing pieces from it. Pieces not in occupancy are still returned, so callers
+// removing pieces from the board should mask the result with the occupancy.
+// Pins are not considered. Externally useful for evaluation functions.
+func (b *Board) AttackersTo(sq Square, occupancy uint64) uint64 {
+	origin := uint8(sq)
+	diagonalSliders := b.White.Bishops | b.White.Queens | b.Black.Bishops | b.Black.Queens
+	orthogonalSliders := b.White.Rooks | b.White.Queens | b.Black.Rooks | b.Black.Queens
+	return knightMasks[origin]&(b.White.Knights|b.Black.Knights) |
+		kingMasks[origin]&(b.White.Kings|b.Black.Kings) |
+		pawnAttackerMask(true, origin)&b.Black.Pawns |
+		pawnAttackerMask(false, origin)&b.White.Pawns |
+		CalculateBishopMoveBitboard(origin, occupancy)&diagonalSliders |
+		CalculateRookMoveBitboard(origin, occupancy)&orthogonalSliders
+}
+
+// Returns every square attacked by the given side, including squares occupied by its
+// own pieces (i.e., defended pieces). Pins are not considered.
+// Externally useful for evaluation functions, e.g. for king safety and mobility.
+func (b *Board) AttackedSquares(white bool) uint64 {
+	var ourPieces *Bitboards
+	if white {
+		ourPieces = &b.White
+	} else {
+		ourPieces = &b.Black
+	}
+	allPieces := b.White.All | b.Black.All
+	var attacked uint64
+	if white {
+		attacked = (ourPieces.Pawns<<7)&^onlyFile[7] | (ourPieces.Pawns<<9)&^onlyFile[0]
+	} else {
+		attacked = (ourPieces.Pawns>>9)&^onlyFile[7] | (ourPieces.Pawns>>7)&^onlyFile[0]
+	}
+	for knights := ourPieces.Knights; knights != 0; knights &= knights - 1 {
+		attacked |= knightMasks[bits.TrailingZeros64(knights)]
+	}
+	for diagonal := ourPieces.Bishops | ourPieces.Queens; diagonal != 0; diagonal &= diagonal - 1 {
+		attacked |= CalculateBishopMoveBitboard(uint8(bits.TrailingZeros64(diagonal)), allPieces)
+	}
+	for orthogonal := ourPieces.Rooks | ourPieces.Queens; orthogonal != 0; orthogonal &= orthogonal - 1 {
+		attacked |= CalculateRookMoveBitboard(uint8(bits.TrailingZeros64(orthogonal)), allPieces)
+	}
+	if ourPieces.Kings != 0 {
+		attacked |= kingMasks[bits.TrailingZeros64(ourPieces.Kings)]
+	}
+	return attacked
+}
+
+// Returns the opponent pieces giving check to the king of the side to move.
+func (b *Board) Checkers() uint64 {
+	ourKings, oppPieces := b.White.Kings, b.Black.All
+	if !b.Wtomove {
+		ourKings, oppPieces = b.Black.Kings, b.White.All
+	}
+	if ourKings == 0 {
+		return 0
+	}
+	return b.AttackersTo(Square(bits.TrailingZeros64(ourKings)), b.White.All|b.Black.All) & oppPieces
+}
+
+// Returns the pieces of the given side that are absolutely pinned to their king.
+// A pinned piece may still move along the line between the king and the pinning piece.
+func (b *Board) Pinned(white bool) uint64 {
+	if white {
+		return b.sliderBlockers(b.White.Kings, &b.Black, b.White.All)
+	}
+	return b.sliderBlockers(b.Black.Kings, &b.White, b.Black.All)
+}
+
+// Returns the pieces of the side to move that would give discovered check by moving
+// off the line between the opponent king and one of our sliders.
+func (b *Board) DiscoveredCheckCandidates() uint64 {
+	if b.Wtomove {
+		return b.sliderBlockers(b.Black.Kings, &b.White, b.White.All)
+	}
+	return b.sliderBlockers(b.White.Kings, &b.Black, b.Black.All)
+}
+
+// Returns the pieces in candidates that are the only piece between the king and one of
+// the sliders of the attacker.
+func (b *Board) sliderBlockers(king uint64, attacker *Bitboards, candidates uint64) uint64 {
+	if king == 0 {
+		return 0
+	}
+	kingSq := uint8(bits.TrailingZeros64(king))
+	allPieces := b.White.All | b.Black.All
+	snipers := CalculateRookMoveBitboard(kingSq, 0)&(attacker.Rooks|attacker.Queens) |
+		CalculateBishopMoveBitboard(kingSq, 0)&(attacker.Bishops|attacker.Queens)
+	var blockers uint64
+	for ; snipers != 0; snipers &= snipers - 1 {
+		between := betweenMasks[kingSq][bits.TrailingZeros64(snipers)] & allPieces
+		if between != 0 && between&(between-1) == 0 {
+			blockers |= between & candidates
+		}
+	}
+	return blockers
+}
+
+// Returns whether a legal move gives check, without applying it. This includes discovered
+// checks, checks by the rook when castling, and checks discovered by an en passant capture.
+func (b *Board) GivesCheck(m Move) bool {
+	ourPieces, oppKings := &b.White, b.Black.Kings
+	if !b.Wtomove {
+		ourPieces, oppKings = &b.Black, b.White.Kings
+	}
+	if oppKings == 0 {
+		return false
+	}
+	kingSq := uint8(bits.TrailingZeros64(oppKings))
+	from, to := m.From(), m.To()
+	fromBB, toBB := uint64(1)<<from, uint64(1)<<to
+	piece := b.pieces[from]
+	if m.Promote() != Nothing {
+		piece = m.Promote()
+	}
+
+	// Find the occupancy and our sliders after the move; the moved piece is added below.
+	occupancy := (b.White.All|b.Black.All)&^fromBB | toBB
+	orthogonal := (ourPieces.Rooks | ourPieces.Queens) &^ fromBB
+	diagonal := (ourPieces.Bishops | ourPieces.Queens) &^ fromBB
+	if castle, kingside := b.isCastle(m); castle {
+		rookFrom, kingTo, rookTo := b.castlingSquares(from, kingside)
+		rookFromBB, rookToBB := uint64(1)<<rookFrom, uint64(1)<<rookTo
+		occupancy = (b.White.All|b.Black.All)&^fromBB&^rookFromBB | uint64(1)<<kingTo | rookToBB
+		orthogonal = orthogonal&^rookFromBB | rookToBB
+	} else if piece == Pawn && to == b.enpassant && b.enpassant != 0 {
+		if b.Wtomove {
+			occupancy &^= toBB >> 8
+		} else {
+			occupancy &^= toBB << 8
+		}
+	}
+
+	switch piece {
+	case Pawn:
+		if pawnAttackerMask(!b.Wtomove, kingSq)&toBB != 0 {
+			return true
+		}
+	case Knight:
+		if knightMasks[to]&oppKings != 0 {
+			return true
+		}
+	case Bishop:
+		diagonal |= toBB
+	case Rook:
+		orthogonal |= toBB
+	case Queen:
+		diagonal |= toBB
+		orthogonal |= toBB
+	}
+	return CalculateRookMoveBitboard(kingSq, occupancy)&orthogonal != 0 ||
+		CalculateBishopMoveBitboard(kingSq, occupancy)&diagonal != 0
+}
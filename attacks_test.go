@@ -0,0 +1,167 @@
+package dragontoothmg
+
+import (
+	"testing"
+)
+
+func TestPieceAttacks(t *testing.T) {
+	sq := func(alg string) uint64 {
+		return uint64(1) << algebraicToIndexFatal(alg)
+	}
+	if KnightAttacks(Square(algebraicToIndexFatal("a1"))) != sq("b3")|sq("c2") {
+		t.Error("Wrong knight attacks from a1")
+	}
+	if KingAttacks(Square(algebraicToIndexFatal("h8"))) != sq("g8")|sq("g7")|sq("h7") {
+		t.Error("Wrong king attacks from h8")
+	}
+	pawnTests := []struct {
+		from     string
+		white    bool
+		expected uint64
+	}{
+		{"e4", true, sq("d5") | sq("f5")},
+		{"e4", false, sq("d3") | sq("f3")},
+		{"a2", false, sq("b1")},
+		{"h7", true, sq("g8")},
+	}
+	for _, test := range pawnTests {
+		if PawnAttacks(Square(algebraicToIndexFatal(test.from)), test.white) != test.expected {
+			t.Error("Wrong pawn attacks from", test.from, "for white:", test.white)
+		}
+	}
+}
+
+func TestAttackersTo(t *testing.T) {
+	b := ParseFen(Startpos)
+	f3 := Square(algebraicToIndexFatal("f3"))
+	all := b.White.All | b.Black.All
+	expected := uint64(1)<<algebraicToIndexFatal("e2") | uint64(1)<<algebraicToIndexFatal("g2") |
+		uint64(1)<<algebraicToIndexFatal("g1")
+	if b.AttackersTo(f3, all) != expected {
+		t.Error("Wrong attackers of f3 in the starting position")
+	}
+	// Removing a blocker reveals the slider behind it.
+	b = ParseFen("4k3/8/8/3r4/8/8/3R4/3RK3 w - - 0 1")
+	d5 := Square(algebraicToIndexFatal("d5"))
+	all = b.White.All | b.Black.All
+	d1, d2 := uint64(1)<<algebraicToIndexFatal("d1"), uint64(1)<<algebraicToIndexFatal("d2")
+	if b.AttackersTo(d5, all) != d2 || b.AttackersTo(d5, all&^d2)&(all&^d2) != d1 {
+		t.Error("Wrong x-ray attackers of d5")
+	}
+}
+
+func TestAttackedSquares(t *testing.T) {
+	positions := []string{
+		Startpos,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		"r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 w - - 0 10",
+	}
+	for _, fen := range positions {
+		b := ParseFen(fen)
+		all := b.White.All | b.Black.All
+		for _, white := range []bool{true, false} {
+			side := b.Black.All
+			if white {
+				side = b.White.All
+			}
+			attacked := b.AttackedSquares(white)
+			for sq := uint8(0); sq < 64; sq++ {
+				if bitSet(attacked, sq) != (b.AttackersTo(Square(sq), all)&side != 0) {
+					t.Error("AttackedSquares and AttackersTo disagree on", IndexToAlgebraic(Square(sq)), "in", fen)
+				}
+			}
+		}
+	}
+}
+
+func TestLineMasks(t *testing.T) {
+	sq := func(alg string) uint64 {
+		return uint64(1) << algebraicToIndexFatal(alg)
+	}
+	a1, h8, c3 := algebraicToIndexFatal("a1"), algebraicToIndexFatal("h8"), algebraicToIndexFatal("c3")
+	if betweenMasks[a1][c3] != sq("b2") || betweenMasks[c3][a1] != sq("b2") {
+		t.Error("Wrong squares between a1 and c3")
+	}
+	if lineMasks[c3][h8] != 0x8040201008040201 || lineMasks[a1][c3] != lineMasks[h8][c3] {
+		t.Error("Wrong line through a1 and h8")
+	}
+	e1, e8 := algebraicToIndexFatal("e1"), algebraicToIndexFatal("e8")
+	if betweenMasks[e1][e8] != onlyFile[4]&^(sq("e1")|sq("e8")) || lineMasks[e1][e8] != onlyFile[4] {
+		t.Error("Wrong squares between e1 and e8")
+	}
+	b1 := algebraicToIndexFatal("b1")
+	if betweenMasks[b1][c3] != 0 || lineMasks[b1][c3] != 0 || betweenMasks[a1][a1] != 0 {
+		t.Error("Expected no line between unaligned squares")
+	}
+}
+
+func TestCheckersAndPins(t *testing.T) {
+	sq := func(alg string) uint64 {
+		return uint64(1) << algebraicToIndexFatal(alg)
+	}
+	tests := []struct {
+		fen                     string
+		checkers, whitePinned   uint64
+		blackPinned, discovered uint64
+	}{
+		{Startpos, 0, 0, 0, 0},
+		// The knight on d2 is pinned, the queen and rook on the e-file pin each other,
+		// and the knight on c6 can give discovered check.
+		{"4k3/4r3/2N5/q7/B3Q3/8/3N4/4K3 w - - 0 1", 0, sq("d2") | sq("e4"), sq("e7"), sq("c6")},
+		{"4k3/4r3/2N5/q7/B3Q3/8/3N4/4K3 b - - 0 1", 0, sq("d2") | sq("e4"), sq("e7"), 0},
+		{"1k6/8/8/8/8/3n4/8/4K3 w - - 0 1", sq("d3"), 0, 0, 0},
+		{"1k6/8/8/8/8/8/3p4/4K3 w - - 0 1", sq("d2"), 0, 0, 0},
+		// Two pieces between the king and the slider are not pinned.
+		{"1k6/8/8/q7/1P6/8/3N4/4K3 w - - 0 1", 0, 0, 0, 0},
+		// Double check, by a knight and a discovered rook.
+		{"4k3/8/3N4/8/8/8/8/4RK2 b - - 0 1", sq("d6") | sq("e1"), 0, 0, 0},
+	}
+	for _, test := range tests {
+		b := parseFenAndValidate(t, test.fen)
+		if b.Checkers() != test.checkers {
+			t.Errorf("Expected checkers %x but got %x in %v", test.checkers, b.Checkers(), test.fen)
+		}
+		if b.Pinned(true) != test.whitePinned || b.Pinned(false) != test.blackPinned {
+			t.Errorf("Expected pins %x and %x but got %x and %x in %v", test.whitePinned, test.blackPinned,
+				b.Pinned(true), b.Pinned(false), test.fen)
+		}
+		if b.DiscoveredCheckCandidates() != test.discovered {
+			t.Errorf("Expected discovered check candidates %x but got %x in %v", test.discovered,
+				b.DiscoveredCheckCandidates(), test.fen)
+		}
+	}
+}
+
+func TestGivesCheck(t *testing.T) {
+	positions := []string{
+		Startpos,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+		"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+		"bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9",
+		"5k2/8/8/8/8/8/8/4K2R w K - 0 1",
+		"8/8/8/R2pP2k/8/8/8/4K3 w - d6 0 1",
+		"2k5/4P3/8/8/8/8/8/4K3 w - - 0 1",
+	}
+	var check func(b *Board, depth int)
+	check = func(b *Board, depth int) {
+		for _, m := range b.GenerateLegalMoves() {
+			givesCheck := b.GivesCheck(m)
+			unapply := b.Apply(m)
+			if givesCheck != b.OurKingInCheck() {
+				unapply()
+				t.Fatal("GivesCheck is", givesCheck, "for", m.String(), "in", b.ToFen())
+			}
+			if depth > 1 {
+				check(b, depth-1)
+			}
+			unapply()
+		}
+	}
+	for _, fen := range positions {
+		b := parseFenAndValidate(t, fen)
+		check(&b, 3)
+	}
+}
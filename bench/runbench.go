@@ -33,6 +33,12 @@ func main() {
 	printResultLine(testing.Benchmark(benchmarkKiwipete), "Kiwipete position", kpResult, 5)
 	printResultLine(testing.Benchmark(benchmarkDense), "Dense position", denseResult, 6)
 	printResultLine(testing.Benchmark(benchmarkEndgameRP), "Endgame R/P position", endgameResult, 7)
+	fmt.Println("\nMOVE GENERATION ALLOCATIONS (Kiwipete position)")
+	printAllocLine(testing.Benchmark(benchmarkGenerateLegalMoves), "GenerateLegalMoves")
+	printAllocLine(testing.Benchmark(benchmarkGenerateLegalMovesInto), "GenerateLegalMovesInto")
+	fmt.Println("\nSLIDER LOOKUPS (Kiwipete occupancy, every square)")
+	printTimeLine(testing.Benchmark(benchmarkRookLookups), "CalculateRookMoveBitboard")
+	printTimeLine(testing.Benchmark(benchmarkBishopLookups), "CalculateBishopMoveBitboard")
 	fmt.Println()
 }
 
@@ -41,6 +47,15 @@ func printResultLine(res testing.BenchmarkResult, name string, perftValue int64,
 		perftValue, float64(perftValue) / (float64(res.NsPerOp()) / nsPerS))
 }
 
+func printAllocLine(res testing.BenchmarkResult, name string) {
+	fmt.Printf("%-24s %8dns/op %6d allocs/op %8d B/op\n", name + ":", res.NsPerOp(),
+		res.AllocsPerOp(), res.AllocedBytesPerOp())
+}
+
+func printTimeLine(res testing.BenchmarkResult, name string) {
+	fmt.Printf("%-28s %8dns/op\n", name + ":", res.NsPerOp())
+}
+
 // -----------------
 // BENCHMARK HELPERS
 // -----------------
@@ -89,3 +104,45 @@ func benchmarkEndgameRP(b *testing.B) {
 		endgameResult = dragontoothmg.Perft(&board, 7)
 	}
 }
+
+const kiwipete = "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0"
+
+var movegenResult int
+func benchmarkGenerateLegalMoves(b *testing.B) {
+	b.ReportAllocs()
+	board := dragontoothmg.ParseFen(kiwipete)
+	for i := 0; i < b.N; i++ {
+		movegenResult = len(board.GenerateLegalMoves())
+	}
+}
+
+func benchmarkGenerateLegalMovesInto(b *testing.B) {
+	b.ReportAllocs()
+	board := dragontoothmg.ParseFen(kiwipete)
+	var moves dragontoothmg.MoveList
+	for i := 0; i < b.N; i++ {
+		board.GenerateLegalMovesInto(&moves, dragontoothmg.GenAll)
+		movegenResult = moves.Len()
+	}
+}
+
+var lookupResult uint64
+func benchmarkRookLookups(b *testing.B) {
+	board := dragontoothmg.ParseFen(kiwipete)
+	occupancy := board.White.All | board.Black.All
+	for i := 0; i < b.N; i++ {
+		for sq := uint8(0); sq < 64; sq++ {
+			lookupResult ^= dragontoothmg.CalculateRookMoveBitboard(sq, occupancy)
+		}
+	}
+}
+
+func benchmarkBishopLookups(b *testing.B) {
+	board := dragontoothmg.ParseFen(kiwipete)
+	occupancy := board.White.All | board.Black.All
+	for i := 0; i < b.N; i++ {
+		for sq := uint8(0); sq < 64; sq++ {
+			lookupResult ^= dragontoothmg.CalculateBishopMoveBitboard(sq, occupancy)
+		}
+	}
+}
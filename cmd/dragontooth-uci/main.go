@@ -0,0 +1,212 @@
+// Command dragontooth-uci is a UCI chess engine built on dragontoothmg.
+// It plays with a simple material-only alpha-beta search, and is intended as an
+// example of plugging a uci.Searcher into the protocol loop, and for testing the
+// move generator in GUIs such as cutechess-cli.
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/dylhunn/dragontoothmg"
+	"github.com/dylhunn/dragontoothmg/uci"
+)
+
+func main() {
+	engine := uci.NewEngine("Dragontooth", "Dylan D. Hunn", &searcher{})
+	if err := engine.Run(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+const (
+	infinity  = 1000000
+	mateScore = 100000
+	maxDepth  = 64
+)
+
+var pieceValues = [...]int{dragontoothmg.Nothing: 0, dragontoothmg.Pawn: 100, dragontoothmg.Knight: 300,
+	dragontoothmg.Bishop: 300, dragontoothmg.Rook: 500, dragontoothmg.Queen: 900, dragontoothmg.King: 0}
+
+// An iterative-deepening alpha-beta search, with a quiescence search over captures.
+type searcher struct {
+	game    *dragontoothmg.Game
+	stop    <-chan struct{}
+	stopped bool
+	nodes   int64
+	limit   int64 // node limit, or zero
+}
+
+func (s *searcher) NewGame() {}
+
+func (s *searcher) Options() []uci.Option {
+	return nil
+}
+
+func (s *searcher) SetOption(name, value string) error {
+	return fmt.Errorf("Unknown option %q", name)
+}
+
+func (s *searcher) Search(game *dragontoothmg.Game, limits uci.Limits, stop <-chan struct{}, info func(uci.Info)) dragontoothmg.Move {
+	s.game, s.stop, s.stopped, s.nodes, s.limit = game, stop, false, 0, limits.Nodes
+	depthLimit := limits.Depth
+	if depthLimit <= 0 || depthLimit > maxDepth {
+		depthLimit = maxDepth
+	}
+	b := game.Board()
+	rootMoves := limits.SearchMoves
+	if len(rootMoves) == 0 {
+		rootMoves = b.GenerateLegalMoves()
+	}
+	start := time.Now()
+	var best dragontoothmg.Move
+	for depth := 1; depth <= depthLimit && len(rootMoves) > 0; depth++ {
+		alpha := -infinity
+		var bestThisDepth dragontoothmg.Move
+		for _, m := range rootMoves {
+			game.Push(m)
+			score := -s.alphaBeta(depth-1, 1, -infinity, -alpha)
+			game.Pop()
+			if s.stopped {
+				break
+			}
+			if score > alpha || bestThisDepth == 0 {
+				alpha, bestThisDepth = score, m
+			}
+		}
+		if s.stopped {
+			break
+		}
+		best = bestThisDepth
+		// Search the best move first at the next depth.
+		for i, m := range rootMoves {
+			if m == best {
+				copy(rootMoves[1:i+1], rootMoves[:i])
+				rootMoves[0] = best
+				break
+			}
+		}
+		report := uci.Info{Depth: depth, Score: alpha, Nodes: s.nodes, Time: time.Since(start),
+			PV: []dragontoothmg.Move{best}}
+		if alpha > mateScore-maxDepth*2 {
+			report.Mate = (mateScore - alpha + 1) / 2
+		} else if alpha < -mateScore+maxDepth*2 {
+			report.Mate = -(mateScore + alpha) / 2
+		}
+		info(report)
+		if report.Mate != 0 && !limits.Infinite {
+			break
+		}
+	}
+	if limits.Infinite || limits.Ponder {
+		<-stop // the GUI decides when the search ends
+	}
+	return best
+}
+
+// Returns whether the search should stop, checking the stop channel now and then.
+func (s *searcher) shouldStop() bool {
+	if s.stopped {
+		return true
+	}
+	if s.limit > 0 && s.nodes >= s.limit {
+		s.stopped = true
+	} else if s.nodes&1023 == 0 {
+		select {
+		case <-s.stop:
+			s.stopped = true
+		default:
+		}
+	}
+	return s.stopped
+}
+
+func (s *searcher) alphaBeta(depth int, ply int, alpha int, beta int) int {
+	s.nodes++
+	if s.shouldStop() {
+		return 0
+	}
+	if s.game.RepetitionCount() >= 2 {
+		return 0
+	}
+	b := s.game.Board()
+	var moves dragontoothmg.MoveList
+	b.GenerateLegalMovesInto(&moves, dragontoothmg.GenAll)
+	if moves.Len() == 0 {
+		if b.OurKingInCheck() {
+			return -mateScore + ply
+		}
+		return 0
+	}
+	if b.Halfmoveclock >= 100 {
+		return 0
+	}
+	if depth <= 0 {
+		return s.quiesce(&b, alpha, beta)
+	}
+	for _, m := range moves.Slice() {
+		s.game.Push(m)
+		score := -s.alphaBeta(depth-1, ply+1, -beta, -alpha)
+		s.game.Pop()
+		if score >= beta {
+			return beta
+		}
+		if score > alpha {
+			alpha = score
+		}
+	}
+	return alpha
+}
+
+// Searches captures until the position is quiet. Repetitions are ignored, so there is
+// no need to track the game history.
+func (s *searcher) quiesce(b *dragontoothmg.Board, alpha int, beta int) int {
+	if s.shouldStop() {
+		return 0
+	}
+	standPat := evaluate(b)
+	if standPat >= beta {
+		return beta
+	}
+	if standPat > alpha {
+		alpha = standPat
+	}
+	var moves dragontoothmg.MoveList
+	b.GenerateLegalMovesInto(&moves, dragontoothmg.GenCapturesPromosCheckEvasion)
+	for _, m := range moves.Slice() {
+		if !b.SEEGreaterOrEqual(m, 0) {
+			continue
+		}
+		s.nodes++
+		unapply := b.Apply(m)
+		score := -s.quiesce(b, -beta, -alpha)
+		unapply()
+		if score >= beta {
+			return beta
+		}
+		if score > alpha {
+			alpha = score
+		}
+	}
+	return alpha
+}
+
+// Material balance from the point of view of the side to move.
+func evaluate(b *dragontoothmg.Board) int {
+	score := 0
+	for sq := uint8(0); sq < 64; sq++ {
+		if value := pieceValues[b.PieceAt(sq)]; value != 0 {
+			if b.White.All&(uint64(1)<<sq) != 0 {
+				score += value
+			} else {
+				score -= value
+			}
+		}
+	}
+	if !b.Wtomove {
+		score = -score
+	}
+	return score
+}
@@ -0,0 +1,248 @@
+// Command perftdiff compares the perft divide of dragontoothmg against a reference,
+// to find the position where the move generators disagree.
+//
+// The reference is either a UCI engine that supports "go perft" (such as Stockfish),
+// or a file holding the reference divide of the position at the given depth, one move
+// per line:
+//
+//	e2e4: 9771632
+//	d2d4 = 12306
+//
+// With an engine, perftdiff drills into the first mismatching move until it finds a
+// move that only one of the generators produces, and prints the FEN of the position.
+// With a file, only the position itself is compared, since the file holds no divides
+// of the positions after each move.
+//
+//	perftdiff -fen "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1" -depth 4 -engine stockfish
+//	perftdiff -depth 5 -ref startpos-divide.txt
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dylhunn/dragontoothmg"
+)
+
+// A source of reference divides.
+type reference interface {
+	divide(b *dragontoothmg.Board, depth int) (map[string]int64, error)
+}
+
+func main() {
+	fen := flag.String("fen", dragontoothmg.Startpos, "the position to compare")
+	depth := flag.Int("depth", 4, "the perft depth")
+	engine := flag.String("engine", "", "a UCI engine that supports \"go perft\"")
+	refFile := flag.String("ref", "", "a file holding the reference divide of the position, at the given depth")
+	flag.Parse()
+	*engine = strings.TrimSpace(*engine)
+	if (*engine == "") == (*refFile == "") || *depth < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: perftdiff [-fen FEN] [-depth N] (-engine command | -ref file)")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	b, err := dragontoothmg.ParseFenStrict(*fen)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	var ref reference
+	if *engine != "" {
+		e, err := startEngine(*engine)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer e.close()
+		ref = e
+	} else {
+		ref = &divideFile{path: *refFile}
+	}
+
+	same, err := compare(&b, *depth, ref)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if !same {
+		os.Exit(1)
+	}
+	fmt.Println("The divides match.")
+}
+
+// Compares the divides of the position, drilling into the first move whose counts
+// differ. Returns whether they match.
+func compare(b *dragontoothmg.Board, depth int, ref reference) (bool, error) {
+	expected, err := ref.divide(b, depth)
+	if err != nil {
+		return false, err
+	}
+	results := dragontoothmg.DivideResult(b, depth)
+	actual := make(map[string]int64, len(results))
+	moves := make(map[string]dragontoothmg.Move, len(results))
+	for m, count := range results {
+		actual[m.String()] = count
+		moves[m.String()] = m
+	}
+
+	var names []string
+	for name := range actual {
+		names = append(names, name)
+	}
+	for name := range expected {
+		if _, ok := actual[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	fmt.Printf("Depth %d: %v\n", depth, b.ToFen())
+	var extra, missing []string
+	firstDiff := ""
+	for _, name := range names {
+		count, ok := actual[name]
+		refCount, refOk := expected[name]
+		switch {
+		case !refOk:
+			extra = append(extra, name)
+		case !ok:
+			missing = append(missing, name)
+		case count != refCount:
+			fmt.Printf("  %-6s %12d (reference %d)\n", name, count, refCount)
+			if firstDiff == "" {
+				firstDiff = name
+			}
+		}
+	}
+	if len(extra) > 0 || len(missing) > 0 {
+		fmt.Println("The generators diverge in this position.")
+		if len(extra) > 0 {
+			fmt.Println("  Only generated by dragontoothmg:", strings.Join(extra, " "))
+		}
+		if len(missing) > 0 {
+			fmt.Println("  Only generated by the reference:", strings.Join(missing, " "))
+		}
+		return false, nil
+	}
+	if firstDiff == "" {
+		return true, nil
+	}
+	if _, ok := ref.(*divideFile); ok || depth == 1 {
+		return false, nil
+	}
+	unapply := b.Apply(moves[firstDiff])
+	defer unapply()
+	fmt.Println("After", firstDiff)
+	return compare(b, depth-1, ref)
+}
+
+// Parses a divide, one move per line: "e2e4: 20", "e2e4 = 20" or "e2e4 20".
+// Other lines, such as totals, are ignored.
+func parseDivide(r io.Reader) (map[string]int64, error) {
+	counts := map[string]int64{}
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fields := strings.Fields(strings.NewReplacer(":", " ", "=", " ").Replace(s.Text()))
+		if len(fields) != 2 {
+			continue
+		}
+		if _, err := dragontoothmg.ParseMove(fields[0]); err != nil {
+			continue
+		}
+		count, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid count in divide line %q", s.Text())
+		}
+		counts[fields[0]] = count
+	}
+	return counts, s.Err()
+}
+
+// A reference divide read from a file. It only holds the divide of the position being
+// compared, so it cannot be drilled into.
+type divideFile struct {
+	path string
+}
+
+func (f *divideFile) divide(b *dragontoothmg.Board, depth int) (map[string]int64, error) {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseDivide(file)
+}
+
+// A UCI engine that prints its divide for "go perft", as Stockfish does.
+type engine struct {
+	cmd *exec.Cmd
+	in  io.WriteCloser
+	out *bufio.Scanner
+}
+
+func startEngine(command string) (*engine, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, errors.New("Empty engine command")
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	e := &engine{cmd, in, bufio.NewScanner(out)}
+	fmt.Fprintln(e.in, "uci")
+	if _, err := e.readLines("uciok"); err != nil {
+		e.close()
+		return nil, err
+	}
+	return e, nil
+}
+
+// Reads lines up to and including one starting with prefix, and returns them.
+func (e *engine) readLines(prefix string) ([]string, error) {
+	var lines []string
+	for e.out.Scan() {
+		lines = append(lines, e.out.Text())
+		if strings.HasPrefix(e.out.Text(), prefix) {
+			return lines, nil
+		}
+	}
+	if err := e.out.Err(); err != nil {
+		return nil, err
+	}
+	return nil, errors.New("The engine exited unexpectedly")
+}
+
+func (e *engine) divide(b *dragontoothmg.Board, depth int) (map[string]int64, error) {
+	fmt.Fprintf(e.in, "setoption name UCI_Chess960 value %v\n", b.Chess960)
+	fmt.Fprintf(e.in, "position fen %v\n", b.ToFen())
+	fmt.Fprintf(e.in, "go perft %d\n", depth)
+	lines, err := e.readLines("Nodes searched")
+	if err != nil {
+		return nil, err
+	}
+	return parseDivide(strings.NewReader(strings.Join(lines, "\n")))
+}
+
+func (e *engine) close() {
+	fmt.Fprintln(e.in, "quit")
+	e.in.Close()
+	e.cmd.Wait()
+}
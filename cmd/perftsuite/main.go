@@ -0,0 +1,89 @@
+// Command perftsuite checks the move generator against a file of perft expectations
+// in EPD format, such as the standard perftsuite.epd:
+//
+//	rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - ;D1 20 ;D2 400 ;D3 8902
+//
+// Each position is searched to every depth it has a count for (up to -depth), and
+// the Divide output is printed for each mismatch. The exit status is 1 if any
+// position fails.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/dylhunn/dragontoothmg"
+	"github.com/dylhunn/dragontoothmg/epd"
+)
+
+func main() {
+	maxDepth := flag.Int("depth", 6, "the deepest perft count to check")
+	verbose := flag.Bool("v", false, "print every position as it is checked")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: perftsuite [flags] file.epd")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	start := time.Now()
+	var positions, failures int
+	var nodes int64
+	r := epd.NewReader(f)
+	for {
+		p, err := r.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			fmt.Fprintln(os.Stderr, err)
+			failures++
+			continue
+		}
+		positions++
+		counts, err := p.PerftCounts()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Line %d: %v\n", r.Line(), err)
+			failures++
+			continue
+		}
+		fen := p.Board.ToFen()
+		if *verbose {
+			fmt.Printf("Line %d: %v\n", r.Line(), fen)
+		}
+		for _, depth := range epd.Depths(counts) {
+			if depth > *maxDepth {
+				break
+			}
+			b := p.Board
+			result := dragontoothmg.Perft(&b, depth)
+			nodes += result
+			if result != counts[depth] {
+				failures++
+				fmt.Printf("FAIL line %d: %v\n", r.Line(), fen)
+				fmt.Printf("Depth %d: expected %d, got %d\n", depth, counts[depth], result)
+				dragontoothmg.Divide(&b, depth)
+				break // deeper counts will be wrong too
+			}
+		}
+	}
+
+	elapsed := time.Since(start)
+	fmt.Printf("%d positions, %d failures, %d nodes in %v (%.0f nodes/s)\n",
+		positions, failures, nodes, elapsed.Round(time.Millisecond), float64(nodes)/elapsed.Seconds())
+	if failures > 0 {
+		os.Exit(1)
+	}
+}
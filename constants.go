@@ -2,50 +2,85 @@ package dragontoothmg
 
 import (
 	"math/bits"
-	"math/rand"
 )
 
 // Initialize the magic lookups tables
 func init() {
-	magicMovesRook = make([][]uint64, 64, 64)
-	magicMovesBishop = make([][]uint64, 64, 64)
-	for i := 0; i < 64; i++ {
-		magicMovesRook[i] = make([]uint64, magicDbSizeRook[i], magicDbSizeRook[i])
-		magicMovesBishop[i] = make([]uint64, magicDbSizeBishop[i], magicDbSizeBishop[i])
-	}
 	generateRookMagicTable()
 	generateBishopMagicTable()
+	generateLineMasks()
 	generateZobristConstants()
 }
 
+// The Zobrist constants are drawn from a SplitMix64 generator seeded with zobristSeed,
+// in this order: the side to move, the 12x64 piece-square keys, the 4 castling keys, and
+// the 8 en passant file keys. Hashes are therefore the same in every process, and may be
+// stored. Any change to the seed, the generator or the order must bump ZobristVersion.
 func generateZobristConstants() {
-	whiteToMoveZobristC = rand.Uint64()
+	state := uint64(zobristSeed)
+	whiteToMoveZobristC = splitMix64(&state)
 	for i := 0; i < 12; i++ {
 		for j := 0; j < 64; j++ {
-			pieceSquareZobristC[i][j] = rand.Uint64()
+			pieceSquareZobristC[i][j] = splitMix64(&state)
 		}
 	}
 	for i := 0; i < 4; i++ {
-		castleRightsZobristC[i] = rand.Uint64()
+		castleRightsZobristC[i] = splitMix64(&state)
+	}
+	for i := 0; i < 8; i++ {
+		enpassantZobristC[i] = splitMix64(&state)
 	}
 }
 
+// Returns the next number from a SplitMix64 generator, advancing its state.
+func splitMix64(state *uint64) uint64 {
+	*state += 0x9e3779b97f4a7c15
+	z := *state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
 func generateRookMagicTable() {
 	// For a rook at every board position
+	var offset uint64
 	for i := 0; i < 64; i++ {
 		blockerMask := magicRookBlockerMasks[i]
+		rookMagics[i] = magicEntry{blockerMask, magicNumberRook[i], magicRookShifts[i], offset}
+		offset += magicDbSizeRook[i]
 		generateBlockerPermutations(Square(i), blockerMask, 0, true)
 	}
 }
 
 func generateBishopMagicTable() {
-	// For a bishop at every board position
+	// For a bishop at every board position; the bishop attacks follow the rook attacks
+	var offset uint64 = rookAttackTableSize
 	for i := 0; i < 64; i++ {
 		blockerMask := magicBishopBlockerMasks[i]
+		bishopMagics[i] = magicEntry{blockerMask, magicNumberBishop[i], magicBishopShifts[i], offset}
+		offset += magicDbSizeBishop[i]
 		generateBlockerPermutations(Square(i), blockerMask, 0, false)
 	}
 }
 
+// Fill in betweenMasks and lineMasks, using the magic tables.
+func generateLineMasks() {
+	for a := uint8(0); a < 64; a++ {
+		for b := uint8(0); b < 64; b++ {
+			ends := uint64(1)<<a | uint64(1)<<b
+			if a == b {
+				continue
+			} else if CalculateRookMoveBitboard(a, 0)&(uint64(1)<<b) != 0 {
+				lineMasks[a][b] = CalculateRookMoveBitboard(a, 0)&CalculateRookMoveBitboard(b, 0) | ends
+				betweenMasks[a][b] = CalculateRookMoveBitboard(a, ends) & CalculateRookMoveBitboard(b, ends)
+			} else if CalculateBishopMoveBitboard(a, 0)&(uint64(1)<<b) != 0 {
+				lineMasks[a][b] = CalculateBishopMoveBitboard(a, 0)&CalculateBishopMoveBitboard(b, 0) | ends
+				betweenMasks[a][b] = CalculateBishopMoveBitboard(a, ends) & CalculateBishopMoveBitboard(b, ends)
+			}
+		}
+	}
+}
+
 // Recursively generate all permutations of active and inactive bits in the
 // blocker mask. Origin is the piece's starting square. BlockerMaskProgress is
 // the original blocker bitboard, from which we eliminate bits.
@@ -54,11 +89,9 @@ func generateBlockerPermutations(origin Square, blockerMaskProgress uint64, curr
 	if blockerMaskProgress == 0 {
 		// currPerm represents one possible occupancy pattern on the blocker bitboard
 		if rook {
-			dbindex := (currPerm * magicNumberRook[origin]) >> magicRookShifts[origin]
-			magicMovesRook[origin][dbindex] = rookMovesFromBlockers(origin, currPerm)
+			sliderAttacks[rookMagics[origin].index(currPerm)] = rookMovesFromBlockers(origin, currPerm)
 		} else {
-			dbindex := (currPerm * magicNumberBishop[origin]) >> magicBishopShifts[origin]
-			magicMovesBishop[origin][dbindex] = bishopMovesFromBlockers(origin, currPerm)
+			sliderAttacks[bishopMagics[origin].index(currPerm)] = bishopMovesFromBlockers(origin, currPerm)
 		}
 		return
 	}
@@ -173,12 +206,29 @@ func bishopMovesFromBlockers(origin Square, blockers uint64) uint64 {
 // The starting position FEN
 const Startpos = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
 
+// The version of the Zobrist constants. Hashes computed with different versions
+// are not comparable, so it should be stored alongside any persisted hashes.
+const ZobristVersion = 1
+
+// The seed of the Zobrist constants generator
+const zobristSeed = 0x647261676f6e7468 // "dragonth"
+
 // Zobrist Constants
 var pieceSquareZobristC [12][64]uint64
 var castleRightsZobristC [4]uint64
-var whiteToMoveZobristC uint64 // active if white is to move
+var enpassantZobristC [8]uint64 // indexed by the file of the en passant square
+var whiteToMoveZobristC uint64  // active if white is to move
 
-const kDefaultMoveListLength int = 65
+// The Zobrist key of an en passant square, or zero if there is none.
+func enpassantZobrist(enpassant uint8) uint64 {
+	if enpassant == 0 {
+		return 0
+	}
+	return enpassantZobristC[enpassant%8]
+}
+
+// The capacity of a MoveList. No legal chess position has more than 218 moves.
+const kMaxMoveListLength int = 256
 
 // Bitboard where every bit is active
 var everything uint64 = ^(uint64(0))
@@ -345,6 +395,33 @@ var magicDbSizeBishop = [64]uint64{
 	32, 32, 128, 512, 512, 128, 32, 32, 32, 32, 128, 128, 128, 128, 32, 32,
 	32, 32, 32, 32, 32, 32, 32, 32, 64, 32, 32, 32, 32, 32, 32, 64}
 
-// The actual magic moves database, populated by init
-var magicMovesRook [][]uint64
-var magicMovesBishop [][]uint64
+// The squares strictly between two squares on the same rank, file or diagonal, and
+// the whole line through them. Both are empty for squares that are not aligned.
+var betweenMasks [64][64]uint64
+var lineMasks [64][64]uint64
+
+// The magic bitboard lookup for a slider on one square. The attacks of the slider,
+// given an occupancy, are found at an index of the shared sliderAttacks table.
+type magicEntry struct {
+	mask   uint64 // the blocker mask
+	magic  uint64
+	shift  uint64
+	offset uint64 // the start of this square's attacks in sliderAttacks
+}
+
+// Returns the index in sliderAttacks of the attacks for the given occupancy.
+func (m *magicEntry) index(occupancy uint64) uint64 {
+	return m.offset + ((occupancy&m.mask)*m.magic)>>m.shift
+}
+
+// The sums of magicDbSizeRook and magicDbSizeBishop.
+const rookAttackTableSize = 96256
+const bishopAttackTableSize = 5248
+
+// The magic lookups for each square, populated by init
+var rookMagics [64]magicEntry
+var bishopMagics [64]magicEntry
+
+// The actual magic moves database, populated by init: the attacks for every rook
+// square, followed by those for every bishop square, in one contiguous table.
+var sliderAttacks [rookAttackTableSize + bishopAttackTableSize]uint64
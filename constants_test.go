@@ -63,3 +63,67 @@ func TestBishopMovesFromBlockers(t *testing.T) {
 		t.Error("Failed to generate bishop moves from blocker board. Output:", moves)
 	}
 }
+
+// The magic lookups must agree with the slow move calculation for any occupancy,
+// and each square's attacks must fit in its part of the shared table.
+func TestMagicLookups(t *testing.T) {
+	var rookSize, bishopSize uint64
+	for sq := 0; sq < 64; sq++ {
+		rookSize += magicDbSizeRook[sq]
+		bishopSize += magicDbSizeBishop[sq]
+		if uint64(1)<<(64-rookMagics[sq].shift) > magicDbSizeRook[sq] ||
+			uint64(1)<<(64-bishopMagics[sq].shift) > magicDbSizeBishop[sq] {
+			t.Error("Magic table too small for square", sq)
+		}
+	}
+	if rookSize != rookAttackTableSize || bishopSize != bishopAttackTableSize {
+		t.Error("Wrong attack table sizes", rookSize, bishopSize)
+	}
+	state := uint64(1)
+	for i := 0; i < 10000; i++ {
+		sq := uint8(i % 64)
+		occupancy := splitMix64(&state) & splitMix64(&state)
+		if CalculateRookMoveBitboard(sq, occupancy) != rookMovesFromBlockers(Square(sq), occupancy) {
+			t.Fatal("Wrong rook attacks on square", sq, "for occupancy", occupancy)
+		}
+		if CalculateBishopMoveBitboard(sq, occupancy) != bishopMovesFromBlockers(Square(sq), occupancy) {
+			t.Fatal("Wrong bishop attacks on square", sq, "for occupancy", occupancy)
+		}
+	}
+}
+
+// The Zobrist constants are fixed, so hashes may be stored. If this test fails,
+// ZobristVersion must be bumped.
+func TestZobristHashesAreStable(t *testing.T) {
+	hashes := map[string]uint64{
+		Startpos: 0xbfd9ce927ca737fc,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1": 0x4b35ab387a14b543, // Kiwipete
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1":          0x4239871539b28405,
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1":           0x2b35b6878c12db48,
+	}
+	for fen, hash := range hashes {
+		b := parseFenAndValidate(t, fen)
+		if b.Hash() != hash {
+			t.Errorf("Wrong hash %#016x for %v", b.Hash(), fen)
+		}
+	}
+	if ZobristVersion != 1 {
+		t.Error("Update the expected hashes for the new Zobrist version")
+	}
+}
+
+// Each en passant file has its own key.
+func TestEnpassantZobrist(t *testing.T) {
+	seen := map[uint64]bool{0: true}
+	for _, sq := range []string{"a3", "b3", "c3", "d3", "e3", "f3", "g3", "h3"} {
+		idx, _ := AlgebraicToIndex(sq)
+		key := enpassantZobrist(idx)
+		if seen[key] || enpassantZobrist(idx+24) != key {
+			t.Error("Bad en passant key for", sq)
+		}
+		seen[key] = true
+	}
+	if enpassantZobrist(0) != 0 {
+		t.Error("No en passant square should not change the hash")
+	}
+}
@@ -0,0 +1,261 @@
+// Package epd reads and writes chess positions in Extended Position Description (EPD)
+// format, as used by test suites: the first four fields of a FEN, followed by
+// operations such as bm (best move), am (avoid move), id, or D1 to D6 (perft counts).
+package epd
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dylhunn/dragontoothmg"
+)
+
+// A single operation, such as bm Nf3 Nc3; or id "BK.01";.
+type Operation struct {
+	Opcode   string
+	Operands []string // Without any surrounding quotes
+}
+
+// A position and its operations.
+type Position struct {
+	Board      dragontoothmg.Board
+	Operations []Operation // In the order they were read
+}
+
+// Parses a single EPD line. The hmvc and fmvn operations, if present, set the
+// halfmove clock and fullmove number of the board.
+func Parse(line string) (*Position, error) {
+	fields, rest := splitFields(line, 4)
+	if len(fields) < 4 {
+		return nil, fmt.Errorf("Invalid EPD %q: expected 4 position fields, found %d", line, len(fields))
+	}
+	b, err := dragontoothmg.ParseFenStrict(strings.Join(fields, " "))
+	if err != nil {
+		return nil, err
+	}
+	p := &Position{Board: b}
+	ops, err := splitOperations(rest)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid EPD %q: %v", line, err)
+	}
+	for _, op := range ops {
+		tokens, err := splitOperands(op)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid EPD %q: %v", line, err)
+		}
+		if len(tokens) == 0 {
+			continue
+		}
+		p.Operations = append(p.Operations, Operation{tokens[0], tokens[1:]})
+	}
+
+	if hmvc, ok := p.Operands("hmvc"); ok && len(hmvc) == 1 {
+		n, err := strconv.ParseUint(hmvc[0], 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid EPD %q: bad halfmove clock %q", line, hmvc[0])
+		}
+		p.Board.Halfmoveclock = uint8(n)
+	}
+	if fmvn, ok := p.Operands("fmvn"); ok && len(fmvn) == 1 {
+		n, err := strconv.ParseUint(fmvn[0], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid EPD %q: bad fullmove number %q", line, fmvn[0])
+		}
+		p.Board.Fullmoveno = uint16(n)
+	}
+	return p, nil
+}
+
+// Returns the operands of the first operation with the given opcode, and whether
+// there is one.
+func (p *Position) Operands(opcode string) ([]string, bool) {
+	for _, op := range p.Operations {
+		if op.Opcode == opcode {
+			return op.Operands, true
+		}
+	}
+	return nil, false
+}
+
+// Sets the operands of the operation with the given opcode, adding it if it does not exist.
+func (p *Position) SetOperands(opcode string, operands ...string) {
+	for i := range p.Operations {
+		if p.Operations[i].Opcode == opcode {
+			p.Operations[i].Operands = operands
+			return
+		}
+	}
+	p.Operations = append(p.Operations, Operation{opcode, operands})
+}
+
+// Returns the position's identifier (the id operation), or "" if it has none.
+func (p *Position) ID() string {
+	return p.firstOperand("id")
+}
+
+// Returns the position's primary comment (the c0 operation), or "" if it has none.
+func (p *Position) Comment() string {
+	return p.firstOperand("c0")
+}
+
+func (p *Position) firstOperand(opcode string) string {
+	if operands, _ := p.Operands(opcode); len(operands) > 0 {
+		return operands[0]
+	}
+	return ""
+}
+
+// Returns the best moves of the position (the bm operation), parsed from SAN.
+func (p *Position) BestMoves() ([]dragontoothmg.Move, error) {
+	return p.moves("bm")
+}
+
+// Returns the moves to avoid in the position (the am operation), parsed from SAN.
+func (p *Position) AvoidMoves() ([]dragontoothmg.Move, error) {
+	return p.moves("am")
+}
+
+func (p *Position) moves(opcode string) ([]dragontoothmg.Move, error) {
+	operands, _ := p.Operands(opcode)
+	moves := make([]dragontoothmg.Move, 0, len(operands))
+	b := p.Board
+	for _, san := range operands {
+		m, err := b.ParseSAN(san)
+		if err != nil {
+			return nil, err
+		}
+		moves = append(moves, m)
+	}
+	return moves, nil
+}
+
+// Returns the expected perft counts of the position (the D1, D2, ... operations),
+// by depth.
+func (p *Position) PerftCounts() (map[int]int64, error) {
+	counts := map[int]int64{}
+	for _, op := range p.Operations {
+		if len(op.Opcode) < 2 || op.Opcode[0] != 'D' {
+			continue
+		}
+		depth, err := strconv.Atoi(op.Opcode[1:])
+		if err != nil || depth < 1 {
+			continue // not a perft count
+		}
+		if len(op.Operands) != 1 {
+			return nil, fmt.Errorf("Invalid perft count for %v: expected 1 operand, found %d", op.Opcode, len(op.Operands))
+		}
+		count, err := strconv.ParseInt(op.Operands[0], 10, 64)
+		if err != nil || count < 0 {
+			return nil, fmt.Errorf("Invalid perft count %q for %v", op.Operands[0], op.Opcode)
+		}
+		counts[depth] = count
+	}
+	return counts, nil
+}
+
+// Returns the depths of the perft counts, in ascending order.
+func Depths(counts map[int]int64) []int {
+	depths := make([]int, 0, len(counts))
+	for depth := range counts {
+		depths = append(depths, depth)
+	}
+	sort.Ints(depths)
+	return depths
+}
+
+// Returns the position as an EPD line. Operands of the id and c0 to c9 operations,
+// and any operand containing spaces or semicolons, are quoted.
+func (p *Position) String() string {
+	fields := strings.Fields(p.Board.ToFen())
+	line := strings.Join(fields[:4], " ")
+	for _, op := range p.Operations {
+		line += " " + op.Opcode
+		quote := op.Opcode == "id" || (len(op.Opcode) == 2 && op.Opcode[0] == 'c' && op.Opcode[1] >= '0' && op.Opcode[1] <= '9')
+		for _, operand := range op.Operands {
+			if quote || operand == "" || strings.ContainsAny(operand, " \t;\"") {
+				line += ` "` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(operand) + `"`
+			} else {
+				line += " " + operand
+			}
+		}
+		line += ";"
+	}
+	return line
+}
+
+// Returns the first n whitespace-separated fields of s (or fewer, if s is shorter),
+// and the remainder of s.
+func splitFields(s string, n int) ([]string, string) {
+	var fields []string
+	for len(fields) < n {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" || s[0] == ';' {
+			break
+		}
+		end := strings.IndexAny(s, " \t;")
+		if end < 0 {
+			end = len(s)
+		}
+		fields = append(fields, s[:end])
+		s = s[end:]
+	}
+	return fields, s
+}
+
+// Splits the operations of an EPD line at the semicolons that are not inside quotes.
+// The final operation does not need a semicolon.
+func splitOperations(s string) ([]string, error) {
+	var ops []string
+	start, quoted := 0, false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quoted:
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == ';' && !quoted:
+			ops = append(ops, s[start:i])
+			start = i + 1
+		}
+	}
+	if quoted {
+		return nil, errors.New("unterminated string")
+	}
+	return append(ops, s[start:]), nil
+}
+
+// Splits an operation into its opcode and operands, unquoting string operands.
+func splitOperands(s string) ([]string, error) {
+	var tokens []string
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return tokens, nil
+		}
+		if s[0] != '"' {
+			end := strings.IndexAny(s, " \t")
+			if end < 0 {
+				end = len(s)
+			}
+			tokens = append(tokens, s[:end])
+			s = s[end:]
+			continue
+		}
+		end := 1
+		for end < len(s) && s[end] != '"' {
+			if s[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(s) {
+			return nil, errors.New("unterminated string")
+		}
+		operand := strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(s[1:end])
+		tokens = append(tokens, operand)
+		s = s[end+1:]
+	}
+}
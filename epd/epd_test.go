@@ -0,0 +1,106 @@
+package epd
+
+import (
+	"strings"
+	"testing"
+)
+
+const suite = `# Positions from the perft suite, and from the Bratko-Kopec test
+rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - ;D1 20 ;D2 400 ;D3 8902 ;D4 197281
+
+r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - ;D1 48 ;D2 2039
+1k1r4/pp1b1R2/3q2pp/4p3/2B5/4Q3/PPP2B2/2K5 b - - bm Qd1+; id "BK.01"; c0 "A quiet; tricky move";
+3r1k2/4npp1/1ppr3p/p6P/P2PPPP1/1NR5/5K2/2R5 w - - hmvc 3; fmvn 40; am d5 Rc4; id "BK.02";
+`
+
+func TestReadAll(t *testing.T) {
+	positions, err := ReadAll(strings.NewReader(suite))
+	if err != nil || len(positions) != 4 {
+		t.Fatal("Failed to read the suite:", len(positions), err)
+	}
+
+	counts, err := positions[0].PerftCounts()
+	if err != nil || len(counts) != 4 || counts[1] != 20 || counts[4] != 197281 {
+		t.Error("Wrong perft counts:", counts, err)
+	}
+	if depths := Depths(counts); len(depths) != 4 || depths[0] != 1 || depths[3] != 4 {
+		t.Error("Wrong depths:", depths)
+	}
+	if positions[1].Board.ToFen() != "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1" {
+		t.Error("Wrong position:", positions[1].Board.ToFen())
+	}
+
+	bk := positions[2]
+	if bk.ID() != "BK.01" || bk.Comment() != "A quiet; tricky move" {
+		t.Errorf("Wrong id %q or comment %q", bk.ID(), bk.Comment())
+	}
+	if counts, err := bk.PerftCounts(); err != nil || len(counts) != 0 {
+		t.Error("Unexpected perft counts:", counts, err)
+	}
+	bm, err := bk.BestMoves()
+	if err != nil || len(bm) != 1 || bm[0].String() != "d6d1" {
+		t.Error("Wrong best moves:", bm, err)
+	}
+
+	am, err := positions[3].AvoidMoves()
+	if err != nil || len(am) != 2 || am[0].String() != "d4d5" || am[1].String() != "c3c4" {
+		t.Error("Wrong moves to avoid:", am, err)
+	}
+	if b := positions[3].Board; b.Halfmoveclock != 3 || b.Fullmoveno != 40 {
+		t.Error("Clocks not set from hmvc and fmvn:", b.Halfmoveclock, b.Fullmoveno)
+	}
+}
+
+func TestString(t *testing.T) {
+	line := `1k1r4/pp1b1R2/3q2pp/4p3/2B5/4Q3/PPP2B2/2K5 b - - bm Qd1+; id "BK.01"; c0 "say \"hi\"";`
+	p, err := Parse(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Comment() != `say "hi"` {
+		t.Errorf("Wrong comment %q", p.Comment())
+	}
+	if p.String() != line {
+		t.Errorf("Wrong EPD %q", p.String())
+	}
+	p.SetOperands("bm", "Qd1+", "Qd2")
+	p.SetOperands("D1", "4")
+	expected := `1k1r4/pp1b1R2/3q2pp/4p3/2B5/4Q3/PPP2B2/2K5 b - - bm Qd1+ Qd2; id "BK.01"; c0 "say \"hi\""; D1 4;`
+	if p.String() != expected {
+		t.Errorf("Wrong EPD %q", p.String())
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	lines := []string{
+		"",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNX w KQkq - ;D1 20",
+		`rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - id "unterminated;`,
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - hmvc x;",
+	}
+	for _, line := range lines {
+		if _, err := Parse(line); err == nil {
+			t.Errorf("Parsed invalid EPD %q", line)
+		}
+	}
+
+	p, err := Parse("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - ;D1 x ;bm Nf6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.PerftCounts(); err == nil {
+		t.Error("Accepted an invalid perft count")
+	}
+	if _, err := p.BestMoves(); err == nil {
+		t.Error("Accepted an illegal best move")
+	}
+
+	r := NewReader(strings.NewReader("8/8/8/8/8/8/8/8 w - -\n" + suite))
+	if _, err := r.Next(); err == nil || !strings.HasPrefix(err.Error(), "Line 1:") {
+		t.Error("Expected an error on line 1:", err)
+	}
+	if p, err := r.Next(); err != nil || r.Line() != 3 {
+		t.Error("Failed to continue after an error:", p, err, r.Line())
+	}
+}
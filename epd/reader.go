@@ -0,0 +1,63 @@
+package epd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Reads a sequence of positions from an EPD stream, one per line. Blank lines and
+// lines starting with # are skipped.
+type Reader struct {
+	s    *bufio.Scanner
+	line int
+}
+
+// Creates a Reader that parses positions from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{s: bufio.NewScanner(r)}
+}
+
+// Reads all the positions in r. Stops at the first malformed line.
+func ReadAll(r io.Reader) ([]*Position, error) {
+	var positions []*Position
+	reader := NewReader(r)
+	for {
+		p, err := reader.Next()
+		if err == io.EOF {
+			return positions, nil
+		}
+		if err != nil {
+			return positions, err
+		}
+		positions = append(positions, p)
+	}
+}
+
+// Parses and returns the next position. Returns io.EOF when there are no more
+// positions. If a line is malformed, an error is returned; Next can then be called
+// again to continue with the following line.
+func (r *Reader) Next() (*Position, error) {
+	for r.s.Scan() {
+		r.line++
+		text := strings.TrimSpace(r.s.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		p, err := Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: %v", r.line, err)
+		}
+		return p, nil
+	}
+	if err := r.s.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// Returns the number of the line that was last read.
+func (r *Reader) Line() int {
+	return r.line
+}
@@ -0,0 +1,154 @@
+package dragontoothmg
+
+import (
+	"math/bits"
+)
+
+// The state of a game: still in progress, or finished (or drawable) for some reason.
+type Outcome uint8
+
+const (
+	Ongoing              Outcome = iota
+	Checkmate                    // The side to move has been checkmated
+	Stalemate                    // The side to move has no legal moves, but is not in check
+	FivefoldRepetition           // The position has occurred five times: an automatic draw
+	SeventyFiveMoveRule          // 75 moves by each side without a capture or pawn move: an automatic draw
+	InsufficientMaterial         // Neither side can possibly checkmate: an automatic draw
+	ThreefoldRepetition          // The position has occurred three times: a draw can be claimed
+	FiftyMoveRule                // 50 moves by each side without a capture or pawn move: a draw can be claimed
+)
+
+var outcomeNames = [...]string{"ongoing", "checkmate", "stalemate", "fivefold repetition",
+	"seventy-five-move rule", "insufficient material", "threefold repetition", "fifty-move rule"}
+
+func (o Outcome) String() string {
+	if int(o) < len(outcomeNames) {
+		return outcomeNames[o]
+	}
+	return "unknown"
+}
+
+// Whether the game is over, or a draw can be claimed.
+func (o Outcome) IsDraw() bool {
+	return o >= Stalemate
+}
+
+// A game in progress: a Board along with the history needed to detect repetitions.
+type Game struct {
+	board     Board
+	moves     []Move
+	unapplies []func()
+	keys      []uint64 // repetition keys of every position, including the current one
+}
+
+// Creates a new game starting from the given position.
+func NewGame(b Board) *Game {
+	g := &Game{board: b}
+	g.keys = append(g.keys, g.board.repetitionKey())
+	return g
+}
+
+// Returns the current position. Modifying it does not affect the game.
+func (g *Game) Board() Board {
+	return g.board
+}
+
+// Returns the moves played so far.
+func (g *Game) Moves() []Move {
+	return append([]Move(nil), g.moves...)
+}
+
+// Plays a move, which must be legal in the current position.
+func (g *Game) Push(m Move) {
+	g.unapplies = append(g.unapplies, g.board.Apply(m))
+	g.moves = append(g.moves, m)
+	g.keys = append(g.keys, g.board.repetitionKey())
+}
+
+// Takes back the last move and returns it. Returns the null move if no moves have been played.
+func (g *Game) Pop() Move {
+	if len(g.moves) == 0 {
+		return 0
+	}
+	last := len(g.moves) - 1
+	m := g.moves[last]
+	g.unapplies[last]()
+	g.unapplies = g.unapplies[:last]
+	g.moves = g.moves[:last]
+	g.keys = g.keys[:len(g.keys)-1]
+	return m
+}
+
+// Returns how many times the current position has occurred in the game, including now.
+// Positions count as the same if they have the same pieces, side to move, castling
+// rights and en passant captures available.
+func (g *Game) RepetitionCount() int {
+	current := len(g.keys) - 1
+	count := 1
+	// Only positions since the last capture or pawn move can repeat the current one.
+	earliest := current - int(g.board.Halfmoveclock)
+	if earliest < 0 {
+		earliest = 0
+	}
+	for i := current - 2; i >= earliest; i -= 2 {
+		if g.keys[i] == g.keys[current] {
+			count++
+		}
+	}
+	return count
+}
+
+// Determines whether the game has ended, or a draw can be claimed.
+// Checkmate and stalemate take precedence over everything else, and automatic
+// draws take precedence over claimable ones.
+func (g *Game) Outcome() Outcome {
+	if len(g.board.GenerateLegalMoves()) == 0 {
+		if g.board.OurKingInCheck() {
+			return Checkmate
+		}
+		return Stalemate
+	}
+	repetitions := g.RepetitionCount()
+	switch {
+	case repetitions >= 5:
+		return FivefoldRepetition
+	case g.board.Halfmoveclock >= 150:
+		return SeventyFiveMoveRule
+	case g.board.HasInsufficientMaterial():
+		return InsufficientMaterial
+	case repetitions >= 3:
+		return ThreefoldRepetition
+	case g.board.Halfmoveclock >= 100:
+		return FiftyMoveRule
+	}
+	return Ongoing
+}
+
+// Whether neither side has enough material to checkmate by any sequence of legal moves:
+// only kings and at most one minor piece, or only kings and bishops all on the same color.
+func (b *Board) HasInsufficientMaterial() bool {
+	if b.White.Pawns|b.Black.Pawns|b.White.Rooks|b.Black.Rooks|b.White.Queens|b.Black.Queens != 0 {
+		return false
+	}
+	knights := b.White.Knights | b.Black.Knights
+	bishops := b.White.Bishops | b.Black.Bishops
+	if bits.OnesCount64(knights|bishops) <= 1 {
+		return true
+	}
+	const lightSquares uint64 = 0x55AA55AA55AA55AA
+	return knights == 0 && (bishops&lightSquares == 0 || bishops&^lightSquares == 0)
+}
+
+// The hash of the position, ignoring an en passant square on which no capture is possible.
+// Like Hash, it omits the castling rook squares, which do not change during a game.
+func (b *Board) repetitionKey() uint64 {
+	if b.enpassant == 0 {
+		return b.hash
+	}
+	for _, m := range b.GenerateLegalMoves() {
+		if m.To() == b.enpassant && b.pieces[m.From()] == Pawn {
+			return b.hash
+		}
+	}
+	return b.hash ^ enpassantZobrist(b.enpassant)
+}
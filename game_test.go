@@ -0,0 +1,95 @@
+package dragontoothmg
+
+import (
+	"testing"
+)
+
+func pushAll(g *Game, moves ...string) {
+	for _, m := range moves {
+		g.Push(parseMove(m))
+	}
+}
+
+func TestGameRepetition(t *testing.T) {
+	g := NewGame(ParseFen(Startpos))
+	shuffle := []string{"g1f3", "g8f6", "f3g1", "f6g8"}
+	pushAll(g, shuffle...)
+	if g.RepetitionCount() != 2 || g.Outcome() != Ongoing {
+		t.Error("Expected a single repetition, got", g.RepetitionCount(), g.Outcome())
+	}
+	pushAll(g, shuffle...)
+	if g.RepetitionCount() != 3 || g.Outcome() != ThreefoldRepetition {
+		t.Error("Expected threefold repetition, got", g.RepetitionCount(), g.Outcome())
+	}
+	pushAll(g, shuffle...)
+	pushAll(g, shuffle...)
+	if g.Outcome() != FivefoldRepetition {
+		t.Error("Expected fivefold repetition, got", g.Outcome())
+	}
+	for i := 0; i < 8; i++ {
+		g.Pop()
+	}
+	if g.RepetitionCount() != 3 || len(g.Moves()) != 8 {
+		t.Error("Pop did not restore the history")
+	}
+	b := g.Board()
+	if b.ToFen() != "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 8 5" {
+		t.Error("Pop did not restore the board:", b.ToFen())
+	}
+}
+
+func TestGameRepetitionIrreversible(t *testing.T) {
+	// Losing castling rights makes the position different, even with the same pieces.
+	g := NewGame(ParseFen("r3k3/8/8/8/8/8/8/4K2R w K - 0 1"))
+	pushAll(g, "e1f1", "a8a7", "f1e1", "a7a8", "e1f1", "a8a7", "f1e1", "a7a8")
+	if g.RepetitionCount() != 2 {
+		t.Error("Positions with different castling rights should differ, got", g.RepetitionCount())
+	}
+	// An en passant square without a possible capture doesn't distinguish positions.
+	g = NewGame(ParseFen(Startpos))
+	pushAll(g, "e2e4", "g8f6", "g1f3", "f6g8", "f3g1", "g8f6", "g1f3", "f6g8", "f3g1")
+	if g.RepetitionCount() != 3 {
+		t.Error("Expected the position after e4 to repeat three times, got", g.RepetitionCount())
+	}
+	// But one with a possible capture does.
+	g = NewGame(ParseFen("4k3/8/8/8/4p3/8/3P4/4K3 w - - 0 1"))
+	pushAll(g, "d2d4", "e8d8", "e1d1", "d8e8", "d1e1")
+	if g.RepetitionCount() != 1 {
+		t.Error("En passant availability should distinguish positions, got", g.RepetitionCount())
+	}
+	// A pawn move resets the history window.
+	g = NewGame(ParseFen(Startpos))
+	pushAll(g, "g1f3", "g8f6", "f3g1", "f6g8", "e2e3", "e7e6")
+	if g.RepetitionCount() != 1 {
+		t.Error("Expected no repetition after pawn moves, got", g.RepetitionCount())
+	}
+}
+
+func TestGameOutcome(t *testing.T) {
+	g := NewGame(ParseFen(Startpos))
+	pushAll(g, "f2f3", "e7e5", "g2g4", "d8h4")
+	if g.Outcome() != Checkmate || g.Outcome().IsDraw() {
+		t.Error("Expected checkmate, got", g.Outcome())
+	}
+	outcomes := map[string]Outcome{
+		"7k/5Q2/6K1/8/8/8/8/8 b - - 0 1":                           Stalemate,
+		"4k3/8/8/8/8/8/8/R3K3 w - - 99 80":                         Ongoing,
+		"4k3/8/8/8/8/8/8/R3K3 w - - 100 80":                        FiftyMoveRule,
+		"4k3/8/8/8/8/8/8/R3K3 w - - 150 100":                       SeventyFiveMoveRule,
+		"7k/5Q2/6K1/8/8/8/8/8 b - - 150 100":                       Stalemate,
+		"4k3/8/8/8/8/8/8/4K3 w - - 0 1":                            InsufficientMaterial,
+		"4k3/8/8/8/8/8/8/4KN2 w - - 0 1":                           InsufficientMaterial,
+		"4kb2/8/8/8/8/8/8/4K3 w - - 0 1":                           InsufficientMaterial,
+		"4kb2/8/8/8/8/8/8/2B1K3 w - - 0 1":                         InsufficientMaterial,
+		"4k1b1/8/8/8/8/8/8/2B1K3 w - - 0 1":                        Ongoing,
+		"4k3/8/8/8/8/8/8/3NKN2 w - - 0 1":                          Ongoing,
+		"4k3/8/8/8/8/8/6P1/4K3 w - - 0 1":                          Ongoing,
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1": Ongoing,
+	}
+	for fen, expected := range outcomes {
+		g := NewGame(ParseFen(fen))
+		if g.Outcome() != expected {
+			t.Error("Expected", expected, "but got", g.Outcome(), "for", fen)
+		}
+	}
+}
@@ -12,6 +12,8 @@ import (
 )
 
 // The main API entrypoint. Generates all legal moves for a given board.
+// Breaking change: the moves carry flags, so they are not == to moves from ParseMove;
+// compare them with Move.Base (see Move).
 func (b *Board) GenerateLegalMoves() []Move {
 	moves, _ := b.GenerateLegalMoves2(false)
 	return moves
@@ -23,75 +25,351 @@ func (b *Board) GenerateLegalMoves() []Move {
 //   limited to captures, promotions, and check evasion for quiescence search.
 // Return moves, isInCheck
 func (b *Board) GenerateLegalMoves2(onlyCapturesPromosCheckEvasion bool) ([]Move, bool) {
-	moves := make([]Move, 0, kDefaultMoveListLength)
+	var buf MoveList
+	mode := GenAll
+	if onlyCapturesPromosCheckEvasion {
+		mode = GenCapturesPromosCheckEvasion
+	}
+	isInCheck := b.GenerateLegalMovesInto(&buf, mode)
+	moves := make([]Move, buf.count)
+	copy(moves, buf.moves[:buf.count])
+	return moves, isInCheck
+}
+
+// Generates legal moves into a caller-supplied buffer, without allocating.
+// Any moves already in the buffer are discarded.
+// The mode selects all moves (GenAll), only captures, promotions, and check
+// evasion for quiescence search (GenCapturesPromosCheckEvasion), or only the
+// remaining quiet moves (GenQuiets). Together, the quiet moves and the captures and
+// promotions are all the legal moves; in check, GenQuiets generates nothing, since the
+// check evasions are all generated with the captures.
+// Return isInCheck
+func (b *Board) GenerateLegalMovesInto(moves *MoveList, mode GenMode) bool {
+	onlyCapturesPromosCheckEvasion := mode == GenCapturesPromosCheckEvasion
+	moves.Clear()
 	// First, see if we are currently in check. If we are, invoke a special check-
 	// evasion move generator.
 	var kingLocation uint8
-	var ourPiecesPtr *Bitboards
+	var ourPiecesPtr, oppPiecesPtr *Bitboards
 	if b.Wtomove { // assumes only one king
 		kingLocation = uint8(bits.TrailingZeros64(b.White.Kings))
-		ourPiecesPtr = &(b.White)
+		ourPiecesPtr, oppPiecesPtr = &(b.White), &(b.Black)
 	} else {
 		kingLocation = uint8(bits.TrailingZeros64(b.Black.Kings))
-		ourPiecesPtr = &(b.Black)
+		ourPiecesPtr, oppPiecesPtr = &(b.Black), &(b.White)
 	}
 	kingAttackers, blockerDestinations := b.countAttacks(b.Wtomove, kingLocation, 2)
+	// In check, GenCapturesPromosCheckEvasion already generates every evasion.
+	if kingAttackers >= 1 && mode == GenQuiets {
+		return true
+	}
 	if kingAttackers >= 2 { // Under multiple attack, we must move the king.
-		b.kingPushes(&moves, ourPiecesPtr, everything)
-		return moves, true
+		b.kingPushes(moves, ourPiecesPtr, everything)
+		return true
 	}
 
 	// Several move types can work in single check, but we must block the check
 	if kingAttackers == 1 {
 		// calculate pinned pieces
-		pinnedPieces := b.generatePinnedMoves(&moves, blockerDestinations)
+		pinnedPieces := b.generatePinnedMoves(moves, blockerDestinations)
 		nonpinnedPieces := ^pinnedPieces
 		// TODO
-		b.pawnPushes(&moves, nonpinnedPieces, blockerDestinations)
-		b.pawnCaptures(&moves, nonpinnedPieces, blockerDestinations)
-		b.knightMoves(&moves, nonpinnedPieces, blockerDestinations)
-		b.rookMoves(&moves, nonpinnedPieces, blockerDestinations)
-		b.bishopMoves(&moves, nonpinnedPieces, blockerDestinations)
-		b.queenMoves(&moves, nonpinnedPieces, blockerDestinations)
-		b.kingPushes(&moves, ourPiecesPtr, everything)
-		return moves, true
+		b.pawnPushes(moves, nonpinnedPieces, blockerDestinations)
+		b.pawnCaptures(moves, nonpinnedPieces, blockerDestinations)
+		b.knightMoves(moves, nonpinnedPieces, blockerDestinations)
+		b.rookMoves(moves, nonpinnedPieces, blockerDestinations)
+		b.bishopMoves(moves, nonpinnedPieces, blockerDestinations)
+		b.queenMoves(moves, nonpinnedPieces, blockerDestinations)
+		b.kingPushes(moves, ourPiecesPtr, everything)
+		return true
 	}
 
-	// If we're only interested in captures, then limit destinations to opponent pieces
+	// always generate pawn promos, unless we only want quiet moves
+	promoDest := onlyRank[0]
+	if b.Wtomove {
+		promoDest = onlyRank[7]
+	}
+
+	// If we're only interested in captures, then limit destinations to opponent pieces,
+	// and if we only want quiet moves, exclude them
 	allowDest := everything
 	if onlyCapturesPromosCheckEvasion {
-		allowDest = b.White.All
-		if b.Wtomove {
-			allowDest = b.Black.All
-		}
+		allowDest = oppPiecesPtr.All
+	} else if mode == GenQuiets {
+		allowDest = ^oppPiecesPtr.All
 	}
 
 	// Then, calculate all the absolutely pinned pieces, and compute their moves.
 	// If we are in check, we can only move to squares that block the check.
-	pinnedPieces := b.generatePinnedMoves(&moves, allowDest)
+	pinnedPieces := b.generatePinnedMoves(moves, allowDest)
 	nonpinnedPieces := ^pinnedPieces
 
-	// always generate pawn promos
-	promoDest := onlyRank[0]
+	// Finally, compute ordinary moves, ignoring absolutely pinned pieces on the board.
+	if mode == GenQuiets {
+		b.pawnPushes(moves, nonpinnedPieces, allowDest&^promoDest)
+	} else {
+		b.pawnPushes(moves, nonpinnedPieces, allowDest|promoDest)
+		b.pawnCaptures(moves, nonpinnedPieces, allowDest)
+	}
+	b.knightMoves(moves, nonpinnedPieces, allowDest)
+	b.rookMoves(moves, nonpinnedPieces, allowDest)
+	b.bishopMoves(moves, nonpinnedPieces, allowDest)
+	b.queenMoves(moves, nonpinnedPieces, allowDest)
+	b.kingMoves(moves, allowDest, /*includeCastling*/!onlyCapturesPromosCheckEvasion)
+	return false
+}
+
+// Returns the number of legal moves, as len(b.GenerateLegalMoves()) would, without
+// generating them. Most moves are counted by the popcount of target bitboards, so this
+// is much faster than generating; it is also useful as a mobility measure.
+func (b *Board) CountLegalMoves() int {
+	ourPieces, oppPieces, promoRank := &b.White, &b.Black, onlyRank[7]
+	if !b.Wtomove {
+		ourPieces, oppPieces, promoRank = &b.Black, &b.White, onlyRank[0]
+	}
+	kingLocation := uint8(bits.TrailingZeros64(ourPieces.Kings))
+	allPieces := b.White.All | b.Black.All
+
+	// King moves are checked one at a time, with the king removed from the board.
+	count := 0
+	occupancyWithoutKing := allPieces &^ ourPieces.Kings
+	for targets := kingMasks[kingLocation] &^ ourPieces.All; targets != 0; targets &= targets - 1 {
+		if !b.underAttackWithOccupancy(b.Wtomove, uint8(bits.TrailingZeros64(targets)), occupancyWithoutKing, 0) {
+			count++
+		}
+	}
+	kingAttackers, blockerDestinations := b.countAttacks(b.Wtomove, kingLocation, 2)
+	if kingAttackers >= 2 { // Under multiple attack, we must move the king.
+		return count
+	}
+	allowDest := ^ourPieces.All
+	if kingAttackers == 1 {
+		allowDest &= blockerDestinations
+	} else {
+		for _, kingside := range [2]bool{true, false} {
+			if (kingside && !b.canCastleKingside()) || (!kingside && !b.canCastleQueenside()) {
+				continue
+			}
+			if move, ok := b.castlingCandidate(ourPieces, kingside); ok && b.castlingIsSafe(move, kingside) {
+				count++
+			}
+		}
+	}
+	pinned := b.Pinned(b.Wtomove)
+
+	// Pawns that are not pinned; promotions count once for each promotion piece.
+	var epBitboard uint64
+	if b.enpassant != 0 {
+		epBitboard = uint64(1) << b.enpassant
+	}
+	targets, doubleTargets := b.pawnPushBitboards(^pinned)
+	east, west := b.pawnCaptureBitboards(^pinned)
+	targets, doubleTargets = targets&allowDest, doubleTargets&allowDest
+	east, west = east&allowDest&^epBitboard, west&allowDest&^epBitboard
+	count += bits.OnesCount64(targets) + bits.OnesCount64(doubleTargets) + bits.OnesCount64(east) + bits.OnesCount64(west)
+	count += 3 * (bits.OnesCount64(targets&promoRank) + bits.OnesCount64(east&promoRank) + bits.OnesCount64(west&promoRank))
+
+	// Pinned pieces may only move along the line through the king and the pinning piece.
+	for pieces := ourPieces.All &^ ourPieces.Kings &^ ourPieces.Pawns; pieces != 0; pieces &= pieces - 1 {
+		sq := uint8(bits.TrailingZeros64(pieces))
+		var targets uint64
+		switch b.pieces[sq] {
+		case Knight:
+			targets = knightMasks[sq]
+		case Bishop:
+			targets = CalculateBishopMoveBitboard(sq, allPieces)
+		case Rook:
+			targets = CalculateRookMoveBitboard(sq, allPieces)
+		case Queen:
+			targets = CalculateBishopMoveBitboard(sq, allPieces) | CalculateRookMoveBitboard(sq, allPieces)
+		}
+		if bitSet(pinned, sq) {
+			targets &= lineMasks[kingLocation][sq]
+		}
+		count += bits.OnesCount64(targets & allowDest)
+	}
+	for pawns := ourPieces.Pawns & pinned; pawns != 0; pawns &= pawns - 1 {
+		sq := uint8(bits.TrailingZeros64(pawns))
+		pushes, doublePushes := b.pawnPushBitboards(uint64(1) << sq)
+		targets := (pushes | doublePushes | PawnAttacks(Square(sq), b.Wtomove)&oppPieces.All) &
+			lineMasks[kingLocation][sq] & allowDest
+		count += bits.OnesCount64(targets) + 3*bits.OnesCount64(targets&promoRank)
+	}
+
+	// En passant captures, by pinned pawns or not, are checked one at a time.
+	if b.enpassant != 0 {
+		for pawns := pawnAttackerMask(!b.Wtomove, b.enpassant) & ourPieces.Pawns; pawns != 0; pawns &= pawns - 1 {
+			if !b.enPassantExposesKing(uint8(bits.TrailingZeros64(pawns))) {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// Generates pseudo-legal moves for a given board: moves that follow the rules for
+// how each piece moves, but may leave our king in check. Castling moves are generated
+// if the squares between the king and rook are clear, even if the king is in check or
+// passes through an attacked square. Use IsLegal to check each move before applying it.
+func (b *Board) GeneratePseudoLegalMoves() []Move {
+	var buf MoveList
+	b.GeneratePseudoLegalMovesInto(&buf)
+	moves := make([]Move, buf.count)
+	copy(moves, buf.moves[:buf.count])
+	return moves
+}
+
+// Generates pseudo-legal moves into a caller-supplied buffer, without allocating.
+// Any moves already in the buffer are discarded.
+func (b *Board) GeneratePseudoLegalMovesInto(moves *MoveList) {
+	moves.Clear()
+	ourPiecesPtr := &b.Black
 	if b.Wtomove {
-		promoDest = onlyRank[7]
+		ourPiecesPtr = &b.White
+	}
+	b.pawnPushes(moves, everything, everything)
+	b.pawnCaptures(moves, everything, everything)
+	b.knightMoves(moves, everything, everything)
+	b.rookMoves(moves, everything, everything)
+	b.bishopMoves(moves, everything, everything)
+	b.queenMoves(moves, everything, everything)
+	if b.canCastleKingside() {
+		if move, ok := b.castlingCandidate(ourPiecesPtr, true); ok {
+			moves.push(move)
+		}
 	}
-	
-	// Finally, compute ordinary moves, ignoring absolutely pinned pieces on the board.
-	b.pawnPushes(&moves, nonpinnedPieces, allowDest|promoDest)
-	b.pawnCaptures(&moves, nonpinnedPieces, allowDest)
-	b.knightMoves(&moves, nonpinnedPieces, allowDest)
-	b.rookMoves(&moves, nonpinnedPieces, allowDest)
-	b.bishopMoves(&moves, nonpinnedPieces, allowDest)
-	b.queenMoves(&moves, nonpinnedPieces, allowDest)
-	b.kingMoves(&moves, allowDest, /*includeCastling*/!onlyCapturesPromosCheckEvasion)
-	return moves, false
+	if b.canCastleQueenside() {
+		if move, ok := b.castlingCandidate(ourPiecesPtr, false); ok {
+			moves.push(move)
+		}
+	}
+	ourKingLocation := Square(bits.TrailingZeros64(ourPiecesPtr.Kings))
+	b.genMovesFromTargets(moves, ourKingLocation, kingMasks[ourKingLocation]&^ourPiecesPtr.All)
+}
+
+// Returns whether a pseudo-legal move (as generated by GeneratePseudoLegalMoves) is
+// legal: it does not leave our king in check and, for castling, the king does not
+// castle out of or through check. Does not modify the board.
+func (b *Board) IsLegal(m Move) bool {
+	var ourPiecesPtr *Bitboards
+	var epDelta int8
+	if b.Wtomove {
+		ourPiecesPtr, epDelta = &b.White, -8
+	} else {
+		ourPiecesPtr, epDelta = &b.Black, 8
+	}
+	from, to := uint8(m.From()), uint8(m.To())
+	kingLocation := uint8(bits.TrailingZeros64(ourPiecesPtr.Kings))
+	allPieces := b.White.All | b.Black.All
+	fromBitboard, toBitboard := uint64(1)<<from, uint64(1)<<to
+
+	if from == kingLocation {
+		if castle, kingside := b.isCastle(m); castle {
+			return !b.OurKingInCheck() && b.castlingIsSafe(m, kingside)
+		}
+		// Compute attacks as if the king were absent from the board, to avoid the
+		// king danger problem, aka moving away from a checking slider.
+		return !b.underAttackWithOccupancy(b.Wtomove, to, allPieces&^fromBitboard, toBitboard)
+	}
+
+	// Otherwise, the king must not be attacked after the move.
+	removed := toBitboard
+	if to == b.enpassant && b.enpassant != 0 && bitSet(ourPiecesPtr.Pawns, from) {
+		removed = uint64(1) << uint8(int8(to)+epDelta)
+	}
+	occupancy := allPieces&^fromBitboard&^removed | toBitboard
+	return !b.underAttackWithOccupancy(b.Wtomove, kingLocation, occupancy, removed)
+}
+
+// Returns whether an arbitrary move is legal in the current position. Unlike IsLegal,
+// the move need not come from the move generator: this is meant for moves from
+// transposition tables, killer slots, or untrusted sources. Does not modify the board.
+func (b *Board) IsMoveLegal(m Move) bool {
+	return b.IsPseudoLegal(m) && b.IsLegal(m)
+}
+
+// Returns whether an arbitrary move is pseudo-legal: whether GeneratePseudoLegalMoves
+// would generate it in the current position. The move may have no flags (as from
+// ParseMove), but if it has any, they must match the position. Does not modify the board.
+func (b *Board) IsPseudoLegal(m Move) bool {
+	var ourPiecesPtr, oppPiecesPtr *Bitboards
+	if b.Wtomove {
+		ourPiecesPtr, oppPiecesPtr = &b.White, &b.Black
+	} else {
+		ourPiecesPtr, oppPiecesPtr = &b.Black, &b.White
+	}
+	from, to := uint8(m.From()), uint8(m.To())
+	toBitboard := uint64(1) << to
+	if !bitSet(ourPiecesPtr.All, from) {
+		return false
+	}
+	// A move with flags must have those of this position, so that it can be applied.
+	if m != m.Base() && b.FlagMove(m) != m {
+		return false
+	}
+	piece := b.pieces[from]
+	if piece == King {
+		if castle, kingside := b.isCastle(m); castle {
+			if m.Promote() != Nothing || (kingside && !b.canCastleKingside()) || (!kingside && !b.canCastleQueenside()) {
+				return false
+			}
+			candidate, ok := b.castlingCandidate(ourPiecesPtr, kingside)
+			return ok && candidate.Base() == m.Base()
+		}
+	}
+	if bitSet(ourPiecesPtr.All, to) {
+		return false
+	}
+	allPieces := b.White.All | b.Black.All
+
+	if piece != Pawn {
+		if m.Promote() != Nothing {
+			return false
+		}
+		switch piece {
+		case Knight:
+			return knightMasks[from]&toBitboard != 0
+		case Bishop:
+			return CalculateBishopMoveBitboard(from, allPieces)&toBitboard != 0
+		case Rook:
+			return CalculateRookMoveBitboard(from, allPieces)&toBitboard != 0
+		case Queen:
+			return (CalculateBishopMoveBitboard(from, allPieces)|CalculateRookMoveBitboard(from, allPieces))&toBitboard != 0
+		case King:
+			return kingMasks[from]&toBitboard != 0
+		}
+		return false
+	}
+
+	// Pawns must promote on the last rank, and only to a knight, bishop, rook or queen.
+	forward, startRank, lastRank := int8(8), uint8(1), uint8(7)
+	if !b.Wtomove {
+		forward, startRank, lastRank = -8, 6, 0
+	}
+	if (to/8 == lastRank) != (m.Promote() != Nothing) || m.Promote() == Pawn || m.Promote() > Queen {
+		return false
+	}
+	switch {
+	case int8(to) == int8(from)+forward: // single push
+		return allPieces&toBitboard == 0
+	case int8(to) == int8(from)+2*forward: // double push
+		return from/8 == startRank && allPieces&(toBitboard|uint64(1)<<uint8(int8(from)+forward)) == 0
+	}
+	// A capture, including en passant.
+	if pawnAttackerMask(!b.Wtomove, to)&(uint64(1)<<from) == 0 {
+		return false
+	}
+	if to == b.enpassant && b.enpassant != 0 {
+		// As in the pawn generator, en passant captures that expose our king are rejected.
+		return !b.enPassantExposesKing(from)
+	}
+	return bitSet(oppPiecesPtr.All, to)
 }
 
 // Calculate the available moves for absolutely pinned pieces (pinned to the king).
 // We are only allowed to move to squares in allowDest, to block checks.
 // Return a bitboard of all pieces that are pinned.
-func (b *Board) generatePinnedMoves(moveList *[]Move, allowDest uint64) uint64 {
+func (b *Board) generatePinnedMoves(moveList *MoveList, allowDest uint64) uint64 {
 	var ourKingIdx uint8
 	var ourPieces, oppPieces *Bitboards
 	var allPinnedPieces uint64 = 0
@@ -122,27 +400,31 @@ func (b *Board) generatePinnedMoves(moveList *[]Move, allowDest uint64) uint64 {
 		currRookIdx := uint8(bits.TrailingZeros64(oppRooks))
 		oppRooks &= oppRooks - 1
 		rookTargets := CalculateRookMoveBitboard(currRookIdx, allPieces) & (^(oppPieces.All))
-		// A piece is pinned iff it falls along both attack rays.
-		pinnedPiece := rookTargets & kingOrthoTargets & ourPieces.All
+		// A piece is pinned iff it falls along both attack rays, between the rook and king
+		// (elsewhere, it's just an intersection of the rays).
+		pinnedPiece := rookTargets & kingOrthoTargets & ourPieces.All & betweenMasks[ourKingIdx][currRookIdx]
 		if pinnedPiece == 0 { // there is no pin
 			continue
 		}
 		pinnedPieceIdx := uint8(bits.TrailingZeros64(pinnedPiece))
-		sameRank := pinnedPieceIdx/8 == ourKingIdx/8 && pinnedPieceIdx/8 == currRookIdx/8
-		sameFile := pinnedPieceIdx%8 == ourKingIdx%8 && pinnedPieceIdx%8 == currRookIdx%8
-		if !sameRank && !sameFile {
-			continue // it's just an intersection, not a pin
-		}
 		allPinnedPieces |= pinnedPiece        // store the pinned piece location
 		if pinnedPiece&ourPieces.Pawns != 0 { // it's a pawn; we might be able to push it
-			if sameFile { // push the pawn
+			if pinnedPieceIdx%8 == ourKingIdx%8 { // pinned along a file; push the pawn
 				var pawnTargets uint64 = 0
 				pawnTargets |= (1 << uint8(int(pinnedPieceIdx)+8*pawnPushDirection)) & ^allPieces
 				if pawnTargets != 0 { // single push worked; try double
 					pawnTargets |= (1 << uint8(int(pinnedPieceIdx)+16*pawnPushDirection)) & ^allPieces & doublePushRank
 				}
 				pawnTargets &= allowDest // TODO this might be a promotion. Is that possible?
-				genMovesFromTargets(moveList, Square(pinnedPieceIdx), pawnTargets)
+				for pawnTargets != 0 {
+					target := uint8(bits.TrailingZeros64(pawnTargets))
+					pawnTargets &= pawnTargets - 1
+					move := b.newMove(pinnedPieceIdx, target)
+					if target-pinnedPieceIdx == 16 || pinnedPieceIdx-target == 16 {
+						move |= doublePushMoveFlag
+					}
+					moveList.push(move)
+				}
 			}
 			continue
 		}
@@ -153,9 +435,9 @@ func (b *Board) generatePinnedMoves(moveList *[]Move, allowDest uint64) uint64 {
 		// all ortho moves, as if it was not pinned
 		pinnedPieceAllMoves := CalculateRookMoveBitboard(pinnedPieceIdx, allPieces) & (^(ourPieces.All))
 		// actually available moves
-		pinnedTargets := pinnedPieceAllMoves & (rookTargets | kingOrthoTargets | (uint64(1) << currRookIdx))
+		pinnedTargets := pinnedPieceAllMoves & lineMasks[ourKingIdx][currRookIdx]
 		pinnedTargets &= allowDest
-		genMovesFromTargets(moveList, Square(pinnedPieceIdx), pinnedTargets)
+		b.genMovesFromTargets(moveList, Square(pinnedPieceIdx), pinnedTargets)
 	}
 
 	// Calculate king moves as if it was a bishop.
@@ -166,18 +448,11 @@ func (b *Board) generatePinnedMoves(moveList *[]Move, allowDest uint64) uint64 {
 		currBishopIdx := uint8(bits.TrailingZeros64(oppBishops))
 		oppBishops &= oppBishops - 1
 		bishopTargets := CalculateBishopMoveBitboard(currBishopIdx, allPieces) & (^(oppPieces.All))
-		pinnedPiece := bishopTargets & kingDiagTargets & ourPieces.All
+		pinnedPiece := bishopTargets & kingDiagTargets & ourPieces.All & betweenMasks[ourKingIdx][currBishopIdx]
 		if pinnedPiece == 0 { // there is no pin
 			continue
 		}
 		pinnedPieceIdx := uint8(bits.TrailingZeros64(pinnedPiece))
-		bishopToPinnedSlope := (float32(pinnedPieceIdx)/8 - float32(currBishopIdx)/8) /
-			(float32(pinnedPieceIdx%8) - float32(currBishopIdx%8))
-		bishopToKingSlope := (float32(ourKingIdx)/8 - float32(currBishopIdx)/8) /
-			(float32(ourKingIdx%8) - float32(currBishopIdx%8))
-		if bishopToPinnedSlope != bishopToKingSlope { // just an intersection, not a pin
-			continue
-		}
 		allPinnedPieces |= pinnedPiece // store pinned piece
 		// if it's a pawn we might be able to capture with it
 		// the capture square must also be in allowdest
@@ -187,14 +462,12 @@ func (b *Board) generatePinnedMoves(moveList *[]Move, allowDest uint64) uint64 {
 					(!b.Wtomove && pinnedPieceIdx/8 == (currBishopIdx/8)+1) {
 					if ((uint64(1) << currBishopIdx) & ourPromotionRank) != 0 { // We get to promote!
 						for i := Piece(Knight); i <= Queen; i++ {
-							var move Move
-							move.Setfrom(Square(pinnedPieceIdx)).Setto(Square(currBishopIdx)).Setpromote(i)
-							*moveList = append(*moveList, move)
+							move := b.newMove(pinnedPieceIdx, currBishopIdx)
+							move.Setpromote(i)
+							moveList.push(move)
 						}
 					} else { // no promotion
-						var move Move
-						move.Setfrom(Square(pinnedPieceIdx)).Setto(Square(currBishopIdx))
-						*moveList = append(*moveList, move)
+						moveList.push(b.newMove(pinnedPieceIdx, currBishopIdx))
 					}
 				}
 			}
@@ -207,16 +480,16 @@ func (b *Board) generatePinnedMoves(moveList *[]Move, allowDest uint64) uint64 {
 		// all diag moves, as if it was not pinned
 		pinnedPieceAllMoves := CalculateBishopMoveBitboard(pinnedPieceIdx, allPieces) & (^(ourPieces.All))
 		// actually available moves
-		pinnedTargets := pinnedPieceAllMoves & (bishopTargets | kingDiagTargets | (uint64(1) << currBishopIdx))
+		pinnedTargets := pinnedPieceAllMoves & lineMasks[ourKingIdx][currBishopIdx]
 		pinnedTargets &= allowDest
-		genMovesFromTargets(moveList, Square(pinnedPieceIdx), pinnedTargets)
+		b.genMovesFromTargets(moveList, Square(pinnedPieceIdx), pinnedTargets)
 	}
 	return allPinnedPieces
 }
 
 // Generate moves involving advancing pawns.
 // Only pieces marked nonpinned can be moved. Only squares in allowDest can be moved to.
-func (b *Board) pawnPushes(moveList *[]Move, nonpinned uint64, allowDest uint64) {
+func (b *Board) pawnPushes(moveList *MoveList, nonpinned uint64, allowDest uint64) {
 	targets, doubleTargets := b.pawnPushBitboards(nonpinned)
 
 	oneRankBack := 8
@@ -235,24 +508,24 @@ func (b *Board) pawnPushes(moveList *[]Move, nonpinned uint64, allowDest uint64)
 		} else {
 			canPromote = target <= 7
 		}
-		var move Move
+		move := Move(Pawn) << movedPieceShift
 		move.Setfrom(Square(target + oneRankBack)).Setto(Square(target))
 		if canPromote {
 			for i := Piece(Knight); i <= Queen; i++ {
 				move.Setpromote(i)
-				*moveList = append(*moveList, move)
+				moveList.push(move)
 			}
 		} else {
-			*moveList = append(*moveList, move)
+			moveList.push(move)
 		}
 	}
 	// push some pawns by two squares
 	for doubleTargets != 0 {
 		doubleTarget := bits.TrailingZeros64(doubleTargets)
 		doubleTargets &= doubleTargets - 1 // unset the lowest active bit
-		var move Move
+		move := Move(Pawn)<<movedPieceShift | doublePushMoveFlag
 		move.Setfrom(Square(doubleTarget + 2*oneRankBack)).Setto(Square(doubleTarget))
-		*moveList = append(*moveList, move)
+		moveList.push(move)
 	}
 }
 
@@ -273,7 +546,7 @@ func (b *Board) pawnPushBitboards(nonpinned uint64) (targets uint64, doubleTarge
 
 // A function that computes available pawn captures.
 // Only pieces marked nonpinned can be moved. Only squares in allowDest can be moved to.
-func (b *Board) pawnCaptures(moveList *[]Move, nonpinned uint64, allowDest uint64) {
+func (b *Board) pawnCaptures(moveList *MoveList, nonpinned uint64, allowDest uint64) {
 	east, west := b.pawnCaptureBitboards(nonpinned)
 	if b.enpassant > 0 { // always allow us to try en-passant captures
 		allowDest = allowDest | 1<<b.enpassant
@@ -287,7 +560,8 @@ func (b *Board) pawnCaptures(moveList *[]Move, nonpinned uint64, allowDest uint6
 		for board != 0 {
 			target := bits.TrailingZeros64(board)
 			board &= board - 1
-			var move Move
+			captured := b.pieces[target]
+			move := Move(Pawn)<<movedPieceShift | captureMoveFlag
 			move.Setto(Square(target))
 			canPromote := false
 			if b.Wtomove {
@@ -298,48 +572,60 @@ func (b *Board) pawnCaptures(moveList *[]Move, nonpinned uint64, allowDest uint6
 				canPromote = target <= 7
 			}
 			if uint8(target) == b.enpassant && b.enpassant != 0 {
-				// Apply, check actual legality, then unapply
-				// Warning: not thread safe
-				var ourPieces, oppPieces *Bitboards
-				var enpassantEnemy uint8
-				if b.Wtomove {
-					enpassantEnemy = uint8(move.To()) - 8
-					ourPieces = &(b.White)
-					oppPieces = &(b.Black)
-				} else {
-					enpassantEnemy = uint8(move.To()) + 8
-					ourPieces = &(b.Black)
-					oppPieces = &(b.White)
-				}
-				ourPieces.Pawns &= ^(uint64(1) << move.From())
-				ourPieces.All &= ^(uint64(1) << move.From())
-				ourPieces.Pawns |= (uint64(1) << move.To())
-				ourPieces.All |= (uint64(1) << move.To())
-				oppPieces.Pawns &= ^(uint64(1) << enpassantEnemy)
-				oppPieces.All &= ^(uint64(1) << enpassantEnemy)
-				kingInCheck := b.OurKingInCheck()
-				ourPieces.Pawns |= (uint64(1) << move.From())
-				ourPieces.All |= (uint64(1) << move.From())
-				ourPieces.Pawns &= ^(uint64(1) << move.To())
-				ourPieces.All &= ^(uint64(1) << move.To())
-				oppPieces.Pawns |= (uint64(1) << enpassantEnemy)
-				oppPieces.All |= (uint64(1) << enpassantEnemy)
-				if kingInCheck {
+				if b.enPassantExposesKing(move.From()) {
 					continue
 				}
+				move |= enPassantMoveFlag
+				captured = Pawn
 			}
+			move |= Move(captured) << capturedPieceShift
 			if canPromote {
 				for i := Piece(Knight); i <= Queen; i++ {
 					move.Setpromote(i)
-					*moveList = append(*moveList, move)
+					moveList.push(move)
 				}
 				continue
 			}
-			*moveList = append(*moveList, move)
+			moveList.push(move)
+		}
+	}
+	// A pinned pawn may still capture en passant along the line of the pin.
+	if b.enpassant != 0 {
+		ourPawns := b.Black.Pawns
+		if b.Wtomove {
+			ourPawns = b.White.Pawns
+		}
+		pinnedCapturers := pawnAttackerMask(!b.Wtomove, b.enpassant) & ourPawns &^ nonpinned
+		for ; pinnedCapturers != 0; pinnedCapturers &= pinnedCapturers - 1 {
+			from := uint8(bits.TrailingZeros64(pinnedCapturers))
+			if !b.enPassantExposesKing(from) {
+				move := Move(Pawn)<<movedPieceShift | Move(Pawn)<<capturedPieceShift | captureMoveFlag | enPassantMoveFlag
+				move.Setfrom(Square(from)).Setto(Square(b.enpassant))
+				moveList.push(move)
+			}
 		}
 	}
 }
 
+// Returns whether capturing en passant with the pawn on from would expose our king,
+// using the occupancy after the capture, rather than modifying the board.
+func (b *Board) enPassantExposesKing(from uint8) bool {
+	var ourKings uint64
+	var enpassantEnemy uint8
+	if b.Wtomove {
+		enpassantEnemy = b.enpassant - 8
+		ourKings = b.White.Kings
+	} else {
+		enpassantEnemy = b.enpassant + 8
+		ourKings = b.Black.Kings
+	}
+	capturedPawn := uint64(1) << enpassantEnemy
+	occupancy := (b.White.All | b.Black.All) &^ (uint64(1) << from) &^ capturedPawn
+	occupancy |= uint64(1) << b.enpassant
+	ourKingLocation := uint8(bits.TrailingZeros64(ourKings))
+	return b.underAttackWithOccupancy(b.Wtomove, ourKingLocation, occupancy, capturedPawn)
+}
+
 // A helper than generates bitboards for available pawn captures.
 func (b *Board) pawnCaptureBitboards(nonpinned uint64) (east uint64, west uint64) {
 	notHFile := uint64(0x7F7F7F7F7F7F7F7F)
@@ -366,7 +652,7 @@ func (b *Board) pawnCaptureBitboards(nonpinned uint64) (east uint64, west uint64
 
 // Generate all knight moves.
 // Only pieces marked nonpinned can be moved. Only squares in allowDest can be moved to.
-func (b *Board) knightMoves(moveList *[]Move, nonpinned uint64, allowDest uint64) {
+func (b *Board) knightMoves(moveList *MoveList, nonpinned uint64, allowDest uint64) {
 	var ourKnights, noFriendlyPieces uint64
 	if b.Wtomove {
 		ourKnights = b.White.Knights & nonpinned
@@ -379,43 +665,33 @@ func (b *Board) knightMoves(moveList *[]Move, nonpinned uint64, allowDest uint64
 		currentKnight := bits.TrailingZeros64(ourKnights)
 		ourKnights &= ourKnights - 1
 		targets := knightMasks[currentKnight] & noFriendlyPieces & allowDest
-		genMovesFromTargets(moveList, Square(currentKnight), targets)
+		b.genMovesFromTargets(moveList, Square(currentKnight), targets)
 	}
 }
 
 // Computes king moves excluding castling.
-func (b *Board) kingPushes(moveList *[]Move, ptrToOurBitboards *Bitboards, allowDest uint64) {
+func (b *Board) kingPushes(moveList *MoveList, ptrToOurBitboards *Bitboards, allowDest uint64) {
 	ourKingLocation := uint8(bits.TrailingZeros64(ptrToOurBitboards.Kings))
 	noFriendlyPieces := ^(ptrToOurBitboards.All)
 
-	// TODO(dylhunn): Modifying the board is NOT thread-safe.
-	// We only do this to avoid the king danger problem, aka moving away from a
-	// checking slider.
-	oldKings := ptrToOurBitboards.Kings
-	ptrToOurBitboards.Kings = 0
-	ptrToOurBitboards.All &= ^(uint64(1) << ourKingLocation)
+	// Compute attacks as if the king were absent from the board, to avoid the
+	// king danger problem, aka moving away from a checking slider.
+	occupancyWithoutKing := (b.White.All | b.Black.All) &^ (uint64(1) << ourKingLocation)
 	targets := kingMasks[ourKingLocation] & noFriendlyPieces & allowDest
 	for targets != 0 {
 		target := bits.TrailingZeros64(targets)
 		targets &= targets - 1
-		if b.UnderDirectAttack(b.Wtomove, uint8(target)) {
+		if b.underAttackWithOccupancy(b.Wtomove, uint8(target), occupancyWithoutKing, 0) {
 			continue
 		}
-		var move Move
-		move.Setfrom(Square(ourKingLocation)).Setto(Square(target))
-		*moveList = append(*moveList, move)
+		moveList.push(b.newMove(ourKingLocation, uint8(target)))
 	}
-
-	ptrToOurBitboards.Kings = oldKings
-	ptrToOurBitboards.All |= (1 << ourKingLocation)
 }
 
 // Generate all available king moves.
 // First, if castling is possible, verifies the checking prohibitions on castling.
 // Then, outputs castling moves (if any), and king moves.
-// Not thread-safe, since the king is removed from the board to compute
-// king-danger squares.
-func (b *Board) kingMoves(moveList *[]Move, allowDest uint64, includeCastling bool) {
+func (b *Board) kingMoves(moveList *MoveList, allowDest uint64, includeCastling bool) {
 	var ptrToOurBitboards *Bitboards
 	if b.Wtomove {
 		ptrToOurBitboards = &(b.White)
@@ -424,39 +700,12 @@ func (b *Board) kingMoves(moveList *[]Move, allowDest uint64, includeCastling bo
 	}
 	
 	if includeCastling {
-		// castling
-		var ourKingLocation uint8
-		var canCastleQueenside, canCastleKingside bool
-		allPieces := b.White.All | b.Black.All
-		if b.Wtomove {
-			ourKingLocation = uint8(bits.TrailingZeros64(b.White.Kings))
-			// To castle, we must have rights and a clear path
-			kingsideClear := allPieces&((1<<5)|(1<<6)) == 0
-			queensideClear := allPieces&((1<<3)|(1<<2)|(1<<1)) == 0
-			// skip the king square, since this won't be called while in check
-			canCastleQueenside = b.whiteCanCastleQueenside() &&
-				queensideClear && !b.anyUnderDirectAttack(true, 2, 3)
-			canCastleKingside = b.whiteCanCastleKingside() &&
-				kingsideClear && !b.anyUnderDirectAttack(true, 5, 6)
-		} else {
-			ourKingLocation = uint8(bits.TrailingZeros64(b.Black.Kings))
-			kingsideClear := allPieces&((1<<61)|(1<<62)) == 0
-			queensideClear := allPieces&((1<<57)|(1<<58)|(1<<59)) == 0
-			// skip the king square, since this won't be called while in check
-			canCastleQueenside = b.blackCanCastleQueenside() &&
-				queensideClear && !b.anyUnderDirectAttack(false, 58, 59)
-			canCastleKingside = b.blackCanCastleKingside() &&
-				kingsideClear && !b.anyUnderDirectAttack(false, 61, 62)
+		// castling; this won't be called while in check
+		if b.canCastleKingside() {
+			b.castlingMove(moveList, ptrToOurBitboards, true)
 		}
-		if canCastleKingside {
-			var move Move
-			move.Setfrom(Square(ourKingLocation)).Setto(Square(ourKingLocation + 2))
-			*moveList = append(*moveList, move)
-		}
-		if canCastleQueenside {
-			var move Move
-			move.Setfrom(Square(ourKingLocation)).Setto(Square(ourKingLocation - 2))
-			*moveList = append(*moveList, move)
+		if b.canCastleQueenside() {
+			b.castlingMove(moveList, ptrToOurBitboards, false)
 		}
 	}
 
@@ -464,9 +713,72 @@ func (b *Board) kingMoves(moveList *[]Move, allowDest uint64, includeCastling bo
 	b.kingPushes(moveList, ptrToOurBitboards, allowDest)
 }
 
+// Generates the castling move on the given side, if it is legal.
+// Handles Chess960, where the king and rook may start on any squares of the back rank.
+// The caller must check that we have the castling right, and are not in check.
+func (b *Board) castlingMove(moveList *MoveList, ptrToOurBitboards *Bitboards, kingside bool) {
+	move, ok := b.castlingCandidate(ptrToOurBitboards, kingside)
+	if ok && b.castlingIsSafe(move, kingside) {
+		moveList.push(move)
+	}
+}
+
+// Returns the castling move on the given side, if the rook is in place and every square
+// the king and rook travel over is clear. Does not check for attacks on the king's path.
+// The caller must check that we have the castling right.
+func (b *Board) castlingCandidate(ptrToOurBitboards *Bitboards, kingside bool) (Move, bool) {
+	kingFrom := uint8(bits.TrailingZeros64(ptrToOurBitboards.Kings))
+	rookFrom, kingTo, rookTo := b.castlingSquares(kingFrom, kingside)
+	if !bitSet(ptrToOurBitboards.Rooks, rookFrom) {
+		return 0, false
+	}
+	allPieces := b.White.All | b.Black.All
+	kingAndRook := (uint64(1) << kingFrom) | (uint64(1) << rookFrom)
+	// To castle, every square the king and rook travel over must be clear
+	if (rankSpan(kingFrom, kingTo)|rankSpan(rookFrom, rookTo))&allPieces&^kingAndRook != 0 {
+		return 0, false
+	}
+	move := Move(King)<<movedPieceShift | castleMoveFlag
+	if b.Chess960 {
+		move.Setfrom(Square(kingFrom)).Setto(Square(rookFrom))
+	} else {
+		move.Setfrom(Square(kingFrom)).Setto(Square(kingTo))
+	}
+	return move, true
+}
+
+// Returns whether the king's path when castling is free of attacks.
+// The caller must check that we are not in check.
+func (b *Board) castlingIsSafe(m Move, kingside bool) bool {
+	kingFrom := uint8(m.From())
+	rookFrom, kingTo, rookTo := b.castlingSquares(kingFrom, kingside)
+	allPieces := b.White.All | b.Black.All
+	kingAndRook := (uint64(1) << kingFrom) | (uint64(1) << rookFrom)
+	// The king may not pass through an attacked square
+	kingPath := rankSpan(kingFrom, kingTo) &^ (uint64(1) << kingFrom)
+	for kingPath != 0 {
+		sq := uint8(bits.TrailingZeros64(kingPath))
+		kingPath &= kingPath - 1
+		if b.underAttackWithOccupancy(b.Wtomove, sq, allPieces, 0) {
+			return false
+		}
+	}
+	// In Chess960, the rook may have been shielding the king's destination
+	finalOccupancy := allPieces&^kingAndRook | (uint64(1) << kingTo) | (uint64(1) << rookTo)
+	return !b.underAttackWithOccupancy(b.Wtomove, kingTo, finalOccupancy, 0)
+}
+
+// Returns a bitboard of the squares from a to b inclusive, which must be on the same rank.
+func rankSpan(a uint8, b uint8) uint64 {
+	if a > b {
+		a, b = b, a
+	}
+	return (uint64(1) << (b + 1)) - (uint64(1) << a)
+}
+
 // Generate all rook moves using magic bitboards.
 // Only pieces marked nonpinned can be moved. Only squares in allowDest can be moved to.
-func (b *Board) rookMoves(moveList *[]Move, nonpinned uint64, allowDest uint64) {
+func (b *Board) rookMoves(moveList *MoveList, nonpinned uint64, allowDest uint64) {
 	var ourRooks, friendlyPieces uint64
 	if b.Wtomove {
 		ourRooks = b.White.Rooks & nonpinned
@@ -480,13 +792,13 @@ func (b *Board) rookMoves(moveList *[]Move, nonpinned uint64, allowDest uint64)
 		currRook := uint8(bits.TrailingZeros64(ourRooks))
 		ourRooks &= ourRooks - 1
 		targets := CalculateRookMoveBitboard(currRook, allPieces) & (^friendlyPieces) & allowDest
-		genMovesFromTargets(moveList, Square(currRook), targets)
+		b.genMovesFromTargets(moveList, Square(currRook), targets)
 	}
 }
 
 // Generate all bishop moves using magic bitboards.
 // Only pieces marked nonpinned can be moved. Only squares in allowDest can be moved to.
-func (b *Board) bishopMoves(moveList *[]Move, nonpinned uint64, allowDest uint64) {
+func (b *Board) bishopMoves(moveList *MoveList, nonpinned uint64, allowDest uint64) {
 	var ourBishops, friendlyPieces uint64
 	if b.Wtomove {
 		ourBishops = b.White.Bishops & nonpinned
@@ -500,13 +812,13 @@ func (b *Board) bishopMoves(moveList *[]Move, nonpinned uint64, allowDest uint64
 		currBishop := uint8(bits.TrailingZeros64(ourBishops))
 		ourBishops &= ourBishops - 1
 		targets := CalculateBishopMoveBitboard(currBishop, allPieces) & (^friendlyPieces) & allowDest
-		genMovesFromTargets(moveList, Square(currBishop), targets)
+		b.genMovesFromTargets(moveList, Square(currBishop), targets)
 	}
 }
 
 // Generate all queen moves using magic bitboards.
 // Only pieces marked nonpinned can be moved. Only squares in allowDest can be moved to.
-func (b *Board) queenMoves(moveList *[]Move, nonpinned uint64, allowDest uint64) {
+func (b *Board) queenMoves(moveList *MoveList, nonpinned uint64, allowDest uint64) {
 	var ourQueens, friendlyPieces uint64
 	if b.Wtomove {
 		ourQueens = b.White.Queens & nonpinned
@@ -521,33 +833,31 @@ func (b *Board) queenMoves(moveList *[]Move, nonpinned uint64, allowDest uint64)
 		ourQueens &= ourQueens - 1
 		// bishop motion
 		diag_targets := CalculateBishopMoveBitboard(currQueen, allPieces) & (^friendlyPieces) & allowDest
-		genMovesFromTargets(moveList, Square(currQueen), diag_targets)
+		b.genMovesFromTargets(moveList, Square(currQueen), diag_targets)
 		// rook motion
 		ortho_targets := CalculateRookMoveBitboard(currQueen, allPieces) & (^friendlyPieces) & allowDest
-		genMovesFromTargets(moveList, Square(currQueen), ortho_targets)
+		b.genMovesFromTargets(moveList, Square(currQueen), ortho_targets)
 	}
 }
 
 // Helper: converts a targets bitboard into moves, and adds them to the moves list.
-func genMovesFromTargets(moveList *[]Move, origin Square, targets uint64) {
+func (b *Board) genMovesFromTargets(moveList *MoveList, origin Square, targets uint64) {
 	for targets != 0 {
 		target := bits.TrailingZeros64(targets)
 		targets &= targets - 1
-		var move Move
-		move.Setfrom(origin).Setto(Square(target))
-		*moveList = append(*moveList, move)
+		moveList.push(b.newMove(uint8(origin), uint8(target)))
 	}
 }
 
-// Variadic function that returns whether any of the specified squares is being attacked
-// by the opponent. Potentially expensive.
-func (b *Board) anyUnderDirectAttack(byBlack bool, squares ...uint8) bool {
-	for _, v := range squares {
-		if b.UnderDirectAttack(byBlack, v) {
-			return true
-		}
+// Returns a move with its flags set. Not for castling, en passant or double pawn pushes.
+func (b *Board) newMove(from uint8, to uint8) Move {
+	captured := b.pieces[to]
+	move := Move(b.pieces[from])<<movedPieceShift | Move(captured)<<capturedPieceShift
+	if captured != Nothing {
+		move |= captureMoveFlag
 	}
-	return false
+	move.Setfrom(Square(from)).Setto(Square(to))
+	return move
 }
 
 func (b *Board) OurKingInCheck() bool {
@@ -568,6 +878,42 @@ func (b *Board) UnderDirectAttack(byBlack bool, origin uint8) bool {
 	return count >= 1
 }
 
+// Determine if a square is under attack, given a hypothetical occupancy of the board.
+// Opponent pieces on the squares in removed are ignored (e.g., because they were captured).
+// Does not modify the board, so it can be used to test the legality of a move before making it.
+func (b *Board) underAttackWithOccupancy(byBlack bool, origin uint8, allPieces uint64, removed uint64) bool {
+	var opponentPieces *Bitboards
+	if byBlack {
+		opponentPieces = &(b.Black)
+	} else {
+		opponentPieces = &(b.White)
+	}
+	if knightMasks[origin]&opponentPieces.Knights&^removed != 0 {
+		return true
+	}
+	if kingMasks[origin]&opponentPieces.Kings != 0 {
+		return true
+	}
+	if pawnAttackerMask(byBlack, origin)&opponentPieces.Pawns&^removed != 0 {
+		return true
+	}
+	diagAttackers := (opponentPieces.Bishops | opponentPieces.Queens) &^ removed
+	if diagAttackers != 0 && CalculateBishopMoveBitboard(origin, allPieces)&diagAttackers != 0 {
+		return true
+	}
+	orthoAttackers := (opponentPieces.Rooks | opponentPieces.Queens) &^ removed
+	return orthoAttackers != 0 && CalculateRookMoveBitboard(origin, allPieces)&orthoAttackers != 0
+}
+
+// Returns the squares from which a pawn of the given color would attack the origin square.
+func pawnAttackerMask(byBlack bool, origin uint8) uint64 {
+	originBitboard := uint64(1) << origin
+	if byBlack {
+		return (originBitboard<<7)&^onlyFile[7] | (originBitboard<<9)&^onlyFile[0]
+	}
+	return (originBitboard>>9)&^onlyFile[7] | (originBitboard>>7)&^onlyFile[0]
+}
+
 // Compute whether an individual square is under direct attack. Potentially expensive.
 // Can be asked to abort early, when a certain number of attacks are found.
 // The found number might exceed the abortion threshold, since attacks are grouped.
@@ -590,9 +936,7 @@ func (b *Board) countAttacks(byBlack bool, origin uint8, abortEarly int) (int, u
 		return numAttacks, blockerDestinations
 	}
 	// find attacking bishops and queens
-	diag_candidates := magicBishopBlockerMasks[origin] & allPieces
-	diag_dbindex := (diag_candidates * magicNumberBishop[origin]) >> magicBishopShifts[origin]
-	origin_diag_rays := magicMovesBishop[origin][diag_dbindex]
+	origin_diag_rays := CalculateBishopMoveBitboard(origin, allPieces)
 	diag_attackers := origin_diag_rays & (opponentPieces.Bishops | opponentPieces.Queens)
 	numAttacks += bits.OnesCount64(diag_attackers)
 	blockerDestinations |= diag_attackers
@@ -609,9 +953,7 @@ func (b *Board) countAttacks(byBlack bool, origin uint8, abortEarly int) (int, u
 	}
 
 	// find attacking rooks and queens
-	ortho_candidates := magicRookBlockerMasks[origin] & allPieces
-	ortho_dbindex := (ortho_candidates * magicNumberRook[origin]) >> magicRookShifts[origin]
-	origin_ortho_rays := magicMovesRook[origin][ortho_dbindex]
+	origin_ortho_rays := CalculateRookMoveBitboard(origin, allPieces)
 	ortho_attackers := origin_ortho_rays & (opponentPieces.Rooks | opponentPieces.Queens)
 	numAttacks += bits.OnesCount64(ortho_attackers)
 	blockerDestinations |= ortho_attackers
@@ -635,19 +977,7 @@ func (b *Board) countAttacks(byBlack bool, origin uint8, abortEarly int) (int, u
 		return numAttacks, blockerDestinations
 	}
 	// find attacking pawns
-	var pawn_attackers_mask uint64 = 0
-	if byBlack {
-		pawn_attackers_mask = (1 << (origin + 7)) & ^(onlyFile[7])
-		pawn_attackers_mask |= (1 << (origin + 9)) & ^(onlyFile[0])
-	} else {
-		if origin-7 >= 0 {
-			pawn_attackers_mask = (1 << (origin - 7)) & ^(onlyFile[0])
-		}
-		if origin-9 >= 0 {
-			pawn_attackers_mask |= (1 << (origin - 9)) & ^(onlyFile[7])
-		}
-	}
-	pawn_attackers_mask &= opponentPieces.Pawns
+	pawn_attackers_mask := pawnAttackerMask(byBlack, origin) & opponentPieces.Pawns
 	numAttacks += bits.OnesCount64(pawn_attackers_mask)
 	blockerDestinations |= pawn_attackers_mask
 	if numAttacks >= abortEarly {
@@ -661,10 +991,7 @@ func (b *Board) countAttacks(byBlack bool, origin uint8, abortEarly int) (int, u
 // rookTargets := CalculateRookMoveBitboard(myRookLoc, allPieces) & (^myPieces)
 // Externally useful for evaluation functions.
 func CalculateRookMoveBitboard(currRook uint8, allPieces uint64) uint64 {
-	blockers := magicRookBlockerMasks[currRook] & allPieces
-	dbindex := (blockers * magicNumberRook[currRook]) >> magicRookShifts[currRook]
-	targets := magicMovesRook[currRook][dbindex]
-	return targets
+	return sliderAttacks[rookMagics[currRook].index(allPieces)]
 }
 
 // Calculates the attack bitboard for a bishop. This might include targeted squares
@@ -672,8 +999,5 @@ func CalculateRookMoveBitboard(currRook uint8, allPieces uint64) uint64 {
 // bishopTargets := CalculateBishopMoveBitboard(myBishopLoc, allPieces) & (^myPieces)
 // Externally useful for evaluation functions.
 func CalculateBishopMoveBitboard(currBishop uint8, allPieces uint64) uint64 {
-	blockers := magicBishopBlockerMasks[currBishop] & allPieces
-	dbindex := (blockers * magicNumberBishop[currBishop]) >> magicBishopShifts[currBishop]
-	targets := magicMovesBishop[currBishop][dbindex]
-	return targets
+	return sliderAttacks[bishopMagics[currBishop].index(allPieces)]
 }
@@ -12,12 +12,12 @@ func TestPawnPushes(t *testing.T) {
 		"rnbqkbnr/ppp2pp1/3p4/4p3/3N1P2/P1n5/2PPP3/R1BQKBNR b KQkq - 0 0": 12,
 	}
 	for k, v := range positions {
-		moves := make([]Move, 0, 45)
+		var moves MoveList
 		b := parseFenAndValidate(t, k)
 		b.pawnPushes(&moves, everything, everything)
-		if len(moves) != v {
+		if moves.Len() != v {
 			t.Error("Pawn pushes: wrong length. Expected", v, "but got",
-				len(moves), "for FEN", b.ToFen())
+				moves.Len(), "for FEN", b.ToFen())
 		}
 	}
 }
@@ -29,12 +29,12 @@ func TestPawnCaptures(t *testing.T) {
 		"rnbqkbnr/ppp2pp1/3p4/4pP2/3N4/P1n5/2PPP3/R1BQKBNR w KQkq e6 0 0": 2,
 	}
 	for k, v := range positions {
-		moves := make([]Move, 0, 45)
+		var moves MoveList
 		b := parseFenAndValidate(t, k)
 		b.pawnCaptures(&moves, everything, everything)
-		if len(moves) != v {
+		if moves.Len() != v {
 			t.Error("Pawn captures: wrong length. Expected", v, "but got",
-				len(moves), "for FEN", b.ToFen())
+				moves.Len(), "for FEN", b.ToFen())
 		}
 	}
 }
@@ -63,17 +63,17 @@ func TestKnightPosition0(t *testing.T) {
 	blackpieces := Bitboards{Pawns: blackPawns, Knights: blackKnights, All: blackPawns | blackKnights}
 	testboard := Board{White: whitepieces, Black: blackpieces, Wtomove: true}
 
-	moves := make([]Move, 0, 45)
+	var moves MoveList
 	testboard.knightMoves(&moves, everything, everything)
-	if len(moves) != 20 {
-		t.Error("Knight moves: wrong length. Expected 20, got", len(moves))
+	if moves.Len() != 20 {
+		t.Error("Knight moves: wrong length. Expected 20, got", moves.Len())
 	}
 
 	testboard.Wtomove = false
-	moves2 := make([]Move, 0, 45)
+	var moves2 MoveList
 	testboard.knightMoves(&moves2, everything, everything)
-	if len(moves2) != 27 {
-		t.Error("Knight moves: wrong length. Expected 27, got", len(moves2))
+	if moves2.Len() != 27 {
+		t.Error("Knight moves: wrong length. Expected 27, got", moves2.Len())
 	}
 }
 
@@ -89,12 +89,12 @@ func TestKingPositions(t *testing.T) {
 		"4k3/8/8/8/8/8/8/4K1NR w K - 0 0":                             5, // short castle blocked
 	}
 	for k, v := range positions {
-		moves := make([]Move, 0, 45)
+		var moves MoveList
 		b := parseFenAndValidate(t, k)
 		b.kingMoves(&moves, ^uint64(0), /*includeCastling*/true)
-		if len(moves) != v {
+		if moves.Len() != v {
 			t.Error("King moves: wrong length. Expected", v, "but got",
-				len(moves), "\nFor position:", k)
+				moves.Len(), "\nFor position:", k)
 		}
 	}
 }
@@ -111,11 +111,11 @@ func TestRookPositions(t *testing.T) {
 		"8/8/8/3r4/8/8/8/8 b KQkq -":                            14,
 	}
 	for k, v := range positions {
-		moves := make([]Move, 0, 45)
+		var moves MoveList
 		b := parseFenAndValidate(t, k)
 		b.rookMoves(&moves, everything, everything)
-		if len(moves) != v {
-			t.Error("Rook moves: wrong length. Expected", v, "but got", len(moves))
+		if moves.Len() != v {
+			t.Error("Rook moves: wrong length. Expected", v, "but got", moves.Len())
 		}
 	}
 }
@@ -128,11 +128,11 @@ func TestBishopPositions(t *testing.T) {
 		"rnbqkb1r/pp2pppp/8/4P3/5bN1/8/PPP2PPP/RNBQKBNR b KQkq -": 12,
 	}
 	for k, v := range positions {
-		moves := make([]Move, 0, 45)
+		var moves MoveList
 		b := parseFenAndValidate(t, k)
 		b.bishopMoves(&moves, everything, everything)
-		if len(moves) != v {
-			t.Error("Bishop moves: wrong length. Expected", v, "but got", len(moves))
+		if moves.Len() != v {
+			t.Error("Bishop moves: wrong length. Expected", v, "but got", moves.Len())
 		}
 	}
 }
@@ -145,11 +145,11 @@ func TestQueenPositions(t *testing.T) {
 		"6nq/6p1/2B4n/1rB2r1R/5q2/2P5/1Q4n1/2B5 b - -":         21,
 	}
 	for k, v := range positions {
-		moves := make([]Move, 0, 45)
+		var moves MoveList
 		b := parseFenAndValidate(t, k)
 		b.queenMoves(&moves, everything, everything)
-		if len(moves) != v {
-			t.Error("Queen moves: wrong length. Expected", v, "but got", len(moves))
+		if moves.Len() != v {
+			t.Error("Queen moves: wrong length. Expected", v, "but got", moves.Len())
 		}
 	}
 }
@@ -229,11 +229,11 @@ func TestPinnedBishop(t *testing.T) {
 		"4k3/3b1b2/2Q3Q1/8/8/8/8/4K3 b - - 0 0": 2, // two close pins
 	}
 	for k, v := range positions {
-		moves := make([]Move, 0, 45)
+		var moves MoveList
 		b := parseFenAndValidate(t, k)
 		b.generatePinnedMoves(&moves, everything)
-		if len(moves) != v {
-			t.Error("Legal moves for pinned bishops: wrong length. Expected", v, "but got", len(moves), "for position", b.ToFen())
+		if moves.Len() != v {
+			t.Error("Legal moves for pinned bishops: wrong length. Expected", v, "but got", moves.Len(), "for position", b.ToFen())
 		}
 	}
 }
@@ -244,11 +244,11 @@ func TestPinnedKnight(t *testing.T) {
 		"4k3/8/8/8/1q6/2N5/8/4K3 w - - 0 0":     0, // normal pin
 	}
 	for k, v := range positions {
-		moves := make([]Move, 0, 45)
+		var moves MoveList
 		b := parseFenAndValidate(t, k)
 		b.generatePinnedMoves(&moves, everything)
-		if len(moves) != v {
-			t.Error("Legal moves for pinned bishops: wrong length. Expected", v, "but got", len(moves), "for position", b.ToFen())
+		if moves.Len() != v {
+			t.Error("Legal moves for pinned bishops: wrong length. Expected", v, "but got", moves.Len(), "for position", b.ToFen())
 		}
 	}
 }
@@ -259,11 +259,11 @@ func TestPinnedQueen(t *testing.T) {
 		"4k3/8/4r3/4Q3/1q6/2Q5/8/4K3 w - - 0 0": 6,
 	}
 	for k, v := range positions {
-		moves := make([]Move, 0, 45)
+		var moves MoveList
 		b := parseFenAndValidate(t, k)
 		b.generatePinnedMoves(&moves, everything)
-		if len(moves) != v {
-			t.Error("Legal moves for pinned bishops: wrong length. Expected", v, "but got", len(moves), "for position", b.ToFen())
+		if moves.Len() != v {
+			t.Error("Legal moves for pinned bishops: wrong length. Expected", v, "but got", moves.Len(), "for position", b.ToFen())
 		}
 	}
 }
@@ -292,11 +292,11 @@ func TestDiagPins(t *testing.T) {
 		"4k3/8/8/b7/7q/6P1/8/4K3 w - - 0 0":         algebraicToIndexFatal("g3"),
 	}
 	for k, v := range positions {
-		moves := make([]Move, 0, 45)
+		var moves MoveList
 		b := parseFenAndValidate(t, k)
 		result := b.generatePinnedMoves(&moves, everything)
-		if len(moves) != v {
-			t.Error("Legal moves for diagonal pins: wrong length. Expected", v, "but got", len(moves), "for position", b.ToFen())
+		if moves.Len() != v {
+			t.Error("Legal moves for diagonal pins: wrong length. Expected", v, "but got", moves.Len(), "for position", b.ToFen())
 		}
 		if pinLocs[k] == 64 {
 			if result != 0 {
@@ -314,6 +314,7 @@ func TestTrickyCornerCases(t *testing.T) {
 	positions := map[string]int{
 		"8/8/8/8/k1Pp3Q/8/8/2K5 b - c3 0 0":  5, // e.p. capture into check
 		"8/8/8/8/1kPp4/8/8/2K1B3 b - c3 0 0": 6, // e.p. breaks check
+		"8/6b1/8/4Pp2/8/2K5/8/7k w - f6 0 1": 9, // e.p. along the pin
 	}
 	for k, v := range positions {
 		b := parseFenAndValidate(t, k)
@@ -329,6 +330,19 @@ func TestTrickyCornerCases(t *testing.T) {
 	}
 }
 
+// A pinned pawn may capture en passant along the line of the pin.
+func TestPinnedEnPassant(t *testing.T) {
+	b := parseFenAndValidate(t, "8/6b1/8/4Pp2/8/2K5/8/7k w - f6 0 1")
+	m := b.FlagMove(parseMove("e5f6"))
+	found := false
+	for _, legal := range b.GenerateLegalMoves() {
+		found = found || legal == m
+	}
+	if !found || !m.IsEnPassant() || !b.IsMoveLegal(m) {
+		t.Error("En passant capture along a pin not generated")
+	}
+}
+
 func TestOrthoPins(t *testing.T) {
 	positions := map[string]int{
 		"4k3/8/4r3/4Q3/1q6/2Q5/8/4K3 b - - 0 0":                        2,
@@ -355,12 +369,12 @@ func TestOrthoPins(t *testing.T) {
 		"rnbqkbnr/ppp1pppp/4Q3/8/4p3/8/PPPP1PPP/RNB1KBNR b KQkq - 0 3": algebraicToIndexFatal("e7"), // pawn is pinned with double pawn in file
 	}
 	for k, v := range positions {
-		moves := make([]Move, 0, 45)
+		var moves MoveList
 		b := parseFenAndValidate(t, k)
 		result := b.generatePinnedMoves(&moves, everything)
-		if len(moves) != v {
-			t.Error("Legal moves for orthogonal pins: wrong length. Expected", v, "but got", len(moves), "for position", b.ToFen())
-			printMoves(moves)
+		if moves.Len() != v {
+			t.Error("Legal moves for orthogonal pins: wrong length. Expected", v, "but got", moves.Len(), "for position", b.ToFen())
+			printMoves(moves.Slice())
 		}
 		if pinLocs[k] == 64 {
 			if result != 0 {
@@ -538,7 +552,279 @@ func TestLegalMoves(t *testing.T) {
 		}
 		if len(moves) != v {
 			t.Error("Legal moves: wrong length. Expected", v, "but got", len(moves), "for position\n", b.ToFen())
-			//printMoves(moves)
+			//printMoves(moves.Slice())
+		}
+	}
+}
+
+func TestGenerateLegalMovesInto(t *testing.T) {
+	positions := map[string]int64{
+		Startpos: 8902,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1": 97862,
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1":                            2812,
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1":     9467,
+		"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8":            62379,
+		"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N b - - 0 1":                              9483,
+	}
+	for fen, expected := range positions {
+		b := parseFenAndValidate(t, fen)
+		if result := perftInto(t, &b, 3); result != expected {
+			t.Error("Perft with GenerateLegalMovesInto gives", result, "instead of", expected, "for", fen)
+		}
+		var buf MoveList
+		for _, mode := range []GenMode{GenAll, GenCapturesPromosCheckEvasion, GenQuiets} {
+			allocs := testing.AllocsPerRun(100, func() {
+				b.GenerateLegalMovesInto(&buf, mode)
+			})
+			if allocs != 0 {
+				t.Error("GenerateLegalMovesInto allocated", allocs, "times for", fen)
+			}
+		}
+	}
+}
+
+// Counts perft with GenerateLegalMovesInto, checking at every node that the GenQuiets
+// and GenCapturesPromosCheckEvasion moves together are the GenAll moves, with no overlap.
+func perftInto(t *testing.T, b *Board, depth int) int64 {
+	var all, quiets, noisy MoveList
+	inCheck := b.GenerateLegalMovesInto(&all, GenAll)
+	if b.GenerateLegalMovesInto(&quiets, GenQuiets) != inCheck ||
+		b.GenerateLegalMovesInto(&noisy, GenCapturesPromosCheckEvasion) != inCheck || inCheck != b.OurKingInCheck() {
+		t.Fatal("Wrong check status for", b.ToFen())
+	}
+	remaining := make(map[Move]bool, all.Len())
+	for i := 0; i < all.Len(); i++ {
+		remaining[all.At(i)] = true
+	}
+	for _, m := range append(quiets.Slice(), noisy.Slice()...) {
+		if !remaining[m] {
+			t.Fatal("Move", m.String(), "is not in GenAll, or is generated twice, for", b.ToFen())
+		}
+		delete(remaining, m)
+	}
+	if len(remaining) != 0 {
+		t.Fatal("GenQuiets and GenCapturesPromosCheckEvasion miss", len(remaining), "moves for", b.ToFen())
+	}
+	if depth == 1 {
+		return int64(all.Len())
+	}
+	var count int64
+	for _, m := range all.Slice() {
+		unapply := b.Apply(m)
+		count += perftInto(t, b, depth-1)
+		unapply()
+	}
+	return count
+}
+
+// Move generation must not modify the board, so that several goroutines can share one.
+// Run with -race to detect violations.
+func TestConcurrentGeneration(t *testing.T) {
+	positions := []string{
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/8/8/KPp4r/8/8/8/7k w - c6 0 1",   // en passant exposes the king
+		"8/8/3k4/2pP4/8/8/8/7K w - c6 0 1",  // en passant captures the checking pawn
+		"4k3/8/8/8/8/8/4r3/4K3 w - - 0 1",   // king cannot retreat along the checking ray
+		"4k3/8/8/8/1b6/8/8/r3K2R w K - 0 1", // in check from two pieces
+	}
+	for _, fen := range positions {
+		b := parseFenAndValidate(t, fen)
+		expected := len(b.GenerateLegalMoves())
+		done := make(chan int)
+		for i := 0; i < 8; i++ {
+			go func() {
+				var moves MoveList
+				for j := 0; j < 100; j++ {
+					b.GenerateLegalMovesInto(&moves, GenAll)
+				}
+				done <- moves.Len()
+			}()
+		}
+		for i := 0; i < 8; i++ {
+			if n := <-done; n != expected {
+				t.Error("Concurrent move generation found", n, "moves instead of", expected, "for", fen)
+			}
+		}
+	}
+}
+
+// Checks IsPseudoLegal and IsMoveLegal against the generators for every possible
+// encoded move, in the position and every position one move away from it.
+func checkMoveLegality(t *testing.T, b *Board, depth int) {
+	legal := map[Move]bool{}
+	for _, m := range b.GenerateLegalMoves() {
+		legal[m.Base()] = true
+		// Generated moves are legal with their flags, but not with any others.
+		if b.FlagMove(m) != m || !b.IsMoveLegal(m) || b.IsMoveLegal(m^captureMoveFlag) ||
+			b.IsMoveLegal(m^7<<movedPieceShift) {
+			t.Fatal("Wrong flags for", m.String(), "in", b.ToFen())
 		}
 	}
+	pseudoLegal := map[Move]bool{}
+	for _, m := range b.GeneratePseudoLegalMoves() {
+		pseudoLegal[m.Base()] = true
+		if b.FlagMove(m) != m {
+			t.Fatal("Wrong flags for pseudo-legal", m.String(), "in", b.ToFen())
+		}
+	}
+	for m := Move(0); m < 0x8000; m++ {
+		if b.IsPseudoLegal(m) != pseudoLegal[m] {
+			t.Fatal("IsPseudoLegal is", !pseudoLegal[m], "for", m.String(), "in", b.ToFen())
+		}
+		if b.IsMoveLegal(m) != legal[m] {
+			t.Fatal("IsMoveLegal is", !legal[m], "for", m.String(), "in", b.ToFen())
+		}
+	}
+	if depth > 1 {
+		for m := range legal {
+			unapply := b.Apply(m)
+			checkMoveLegality(t, b, depth-1)
+			unapply()
+		}
+	}
+}
+
+func TestIsMoveLegal(t *testing.T) {
+	positions := []string{
+		Startpos,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 0",
+		"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N b - - 0 1",
+		"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+		// en passant captures that expose the king
+		"8/8/8/KPp4r/8/8/8/7k w - c6 0 1",
+		"8/8/8/8/k1pP3R/8/8/7K b - d3 0 1",
+		"bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9",
+	}
+	for _, fen := range positions {
+		b := parseFenAndValidate(t, fen)
+		checkMoveLegality(t, &b, 2)
+	}
+}
+
+// The quiet moves must be exactly the legal moves that are neither captures nor
+// promotions, in every position of a small search tree.
+func TestGenQuiets(t *testing.T) {
+	positions := []string{
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 0",
+		"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N b - - 0 1",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+		"bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9",
+	}
+	var check func(b *Board, depth int)
+	check = func(b *Board, depth int) {
+		var quiets MoveList
+		b.GenerateLegalMovesInto(&quiets, GenQuiets)
+		generated := map[Move]bool{}
+		for _, m := range quiets.Slice() {
+			generated[m] = true
+		}
+		// In check, the evasions are all generated by GenCapturesPromosCheckEvasion.
+		inCheck := b.OurKingInCheck()
+		expected := 0
+		for _, m := range b.GenerateLegalMoves() {
+			if b.isQuiet(m) && !inCheck {
+				expected++
+				if !generated[m] {
+					t.Fatal("Quiet move", m.String(), "not generated in", b.ToFen())
+				}
+			}
+		}
+		if expected != quiets.Len() {
+			t.Fatal("Wrong number of quiet moves in", b.ToFen())
+		}
+		if depth > 1 {
+			for _, m := range b.GenerateLegalMoves() {
+				unapply := b.Apply(m)
+				check(b, depth-1)
+				unapply()
+			}
+		}
+	}
+	for _, fen := range positions {
+		b := parseFenAndValidate(t, fen)
+		check(&b, 3)
+	}
+}
+
+func TestMoveFlags(t *testing.T) {
+	positions := []string{
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 0",
+		"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N b - - 0 1",
+		"bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9",
+	}
+	var check func(b *Board, depth int)
+	check = func(b *Board, depth int) {
+		for _, m := range b.GenerateLegalMoves() {
+			from, to := m.From(), m.To()
+			moved := b.PieceAt(from)
+			castle, _ := b.isCastle(m)
+			enPassant := moved == Pawn && to == b.enpassant && b.enpassant != 0
+			var captured Piece = Nothing
+			if enPassant {
+				captured = Pawn
+			} else if !castle {
+				captured = b.PieceAt(to)
+			}
+			doublePush := moved == Pawn && (to-from == 16 || from-to == 16)
+			if m.MovedPiece() != moved || m.CapturedPiece() != captured || m.IsCastle() != castle ||
+				m.IsEnPassant() != enPassant || m.IsDoublePush() != doublePush ||
+				m.IsCapture() != (captured != Nothing) || m.IsCapture() != (!castle && IsCapture(m, b)) {
+				t.Fatal("Wrong flags for", m.String(), "in", b.ToFen())
+			}
+			if depth > 1 {
+				unapply := b.Apply(m)
+				check(b, depth-1)
+				unapply()
+			}
+		}
+	}
+	for _, fen := range positions {
+		b := parseFenAndValidate(t, fen)
+		check(&b, 3)
+	}
+}
+
+// The count must match both the legal move generator and the pseudo-legal moves
+// that pass IsLegal, in every position of a small search tree.
+func TestCountLegalMoves(t *testing.T) {
+	positions := []string{
+		Startpos,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 0",
+		"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N b - - 0 1",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+		"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+		"bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9",
+		"8/6b1/8/4Pp2/8/2K5/8/7k w - f6 0 1", // pinned pawn captures en passant along the pin
+		"7K/8/8/8/4pP2/8/2b5/k7 b - f3 0 1",
+		"8/8/8/KPp4r/8/8/8/7k w - c6 0 1",   // en passant would expose the king
+		"1k6/8/8/5pP1/4K3/8/8/8 w - f6 0 1", // en passant captures the checking pawn
+	}
+	var check func(b *Board, depth int)
+	check = func(b *Board, depth int) {
+		moves := b.GenerateLegalMoves()
+		legal := 0
+		for _, m := range b.GeneratePseudoLegalMoves() {
+			if b.IsLegal(m) {
+				legal++
+			}
+		}
+		if count := b.CountLegalMoves(); count != len(moves) || count != legal {
+			t.Fatal("Counted", count, "moves, but generated", len(moves), "of", legal, "in", b.ToFen())
+		}
+		if depth > 1 {
+			for _, m := range moves {
+				unapply := b.Apply(m)
+				check(b, depth-1)
+				unapply()
+			}
+		}
+	}
+	for _, fen := range positions {
+		b := parseFenAndValidate(t, fen)
+		check(&b, 3)
+	}
 }
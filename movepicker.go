@@ -0,0 +1,207 @@
+package dragontoothmg
+
+// The stages of a MovePicker. Moves are generated at the start of a stage, so a
+// search that cuts off early never generates the later ones.
+const (
+	pickTTMove = iota
+	pickGenCaptures
+	pickGoodCaptures
+	pickRefutations
+	pickGenQuiets
+	pickQuiets
+	pickBadCaptures
+	pickGenEvasions
+	pickEvasions
+	pickDone
+)
+
+// Yields the legal moves of a position lazily, in the order a search should try them:
+//  1. the transposition table move,
+//  2. captures and promotions that do not lose material (by SEE), most valuable victim
+//     and least valuable attacker first,
+//  3. the killer moves, then the counter move,
+//  4. the other quiet moves, by descending history score,
+//  5. the captures that lose material.
+//
+// When in check, the evasions are yielded instead, after the transposition table move:
+// captures first, then quiet moves by history score.
+// Moves supplied by the caller are checked for legality, so they may come from
+// a hash table or another position. Each move is yielded once.
+// The board must not be modified while picking, except by making a move and
+// unmaking it before the next call to Next.
+type MovePicker struct {
+	b           *Board
+	ttMove      Move
+	refutations [3]Move // the killers and the counter move; zero if unusable
+	history     func(m Move) int
+	inCheck     bool
+	stage       int
+	next        int // the index of the next move to consider in the current stage
+	moves       MoveList
+	scores      [kMaxMoveListLength]int
+	badCaptures MoveList
+}
+
+// Returns a MovePicker for the position. ttMove, the killers and counterMove may be
+// zero if there are none. history scores quiet moves, and may be nil.
+func NewMovePicker(b *Board, ttMove Move, killers [2]Move, counterMove Move, history func(m Move) int) *MovePicker {
+	var mp MovePicker
+	mp.Init(b, ttMove, killers, counterMove, history)
+	return &mp
+}
+
+// Resets a MovePicker for the position, as NewMovePicker does. A MovePicker declared
+// as a local variable and initialized this way does not allocate.
+func (mp *MovePicker) Init(b *Board, ttMove Move, killers [2]Move, counterMove Move, history func(m Move) int) {
+	mp.b, mp.history, mp.stage, mp.next = b, history, pickTTMove, 0
+	mp.moves.Clear()
+	mp.badCaptures.Clear()
+	mp.ttMove = 0
+	// Flags from another position are ignored, and the moves are flagged for this one,
+	// so that they compare equal to the generated moves.
+	if ttMove != 0 && b.IsMoveLegal(ttMove.Base()) {
+		mp.ttMove = b.FlagMove(ttMove)
+	}
+	mp.inCheck = b.OurKingInCheck()
+	for i, m := range [3]Move{killers[0], killers[1], counterMove} {
+		mp.refutations[i] = 0
+		if mp.inCheck || m == 0 || !b.isQuiet(m) || !b.IsMoveLegal(m.Base()) {
+			continue
+		}
+		if m = b.FlagMove(m); m == mp.ttMove {
+			continue
+		}
+		if (i > 0 && m == mp.refutations[0]) || (i > 1 && m == mp.refutations[1]) {
+			continue
+		}
+		mp.refutations[i] = m
+	}
+}
+
+// Returns the next move, or false if all the moves have been yielded.
+func (mp *MovePicker) Next() (Move, bool) {
+	for {
+		switch mp.stage {
+		case pickTTMove:
+			mp.stage = pickGenCaptures
+			if mp.inCheck {
+				mp.stage = pickGenEvasions
+			}
+			if mp.ttMove != 0 {
+				return mp.ttMove, true
+			}
+		case pickGenCaptures:
+			mp.b.GenerateLegalMovesInto(&mp.moves, GenCapturesPromosCheckEvasion)
+			for i, m := range mp.moves.Slice() {
+				mp.scores[i] = mp.b.captureScore(m)
+			}
+			mp.stage, mp.next = pickGoodCaptures, 0
+		case pickGoodCaptures:
+			for mp.next < mp.moves.Len() {
+				m := mp.pickBest()
+				if m == mp.ttMove {
+					continue
+				}
+				if !mp.b.SEEGreaterOrEqual(m, 0) {
+					mp.badCaptures.push(m) // already in order
+					continue
+				}
+				return m, true
+			}
+			mp.stage, mp.next = pickRefutations, 0
+		case pickRefutations:
+			for mp.next < len(mp.refutations) {
+				m := mp.refutations[mp.next]
+				mp.next++
+				if m != 0 {
+					return m, true
+				}
+			}
+			mp.stage = pickGenQuiets
+		case pickGenQuiets:
+			mp.b.GenerateLegalMovesInto(&mp.moves, GenQuiets)
+			for i, m := range mp.moves.Slice() {
+				mp.scores[i] = mp.historyScore(m)
+			}
+			mp.stage, mp.next = pickQuiets, 0
+		case pickQuiets:
+			for mp.next < mp.moves.Len() {
+				m := mp.pickBest()
+				if m == mp.ttMove || m == mp.refutations[0] || m == mp.refutations[1] || m == mp.refutations[2] {
+					continue
+				}
+				return m, true
+			}
+			mp.stage, mp.next = pickBadCaptures, 0
+		case pickBadCaptures:
+			if mp.next < mp.badCaptures.Len() {
+				mp.next++
+				return mp.badCaptures.At(mp.next - 1), true
+			}
+			mp.stage = pickDone
+		case pickGenEvasions:
+			mp.b.GenerateLegalMovesInto(&mp.moves, GenAll)
+			for i, m := range mp.moves.Slice() {
+				if mp.b.isQuiet(m) {
+					mp.scores[i] = mp.historyScore(m)
+				} else {
+					mp.scores[i] = 1<<30 + mp.b.captureScore(m) // captures first
+				}
+			}
+			mp.stage, mp.next = pickEvasions, 0
+		case pickEvasions:
+			for mp.next < mp.moves.Len() {
+				if m := mp.pickBest(); m != mp.ttMove {
+					return m, true
+				}
+			}
+			mp.stage = pickDone
+		default:
+			return 0, false
+		}
+	}
+}
+
+// Moves the highest-scored remaining move of the stage to the next index, and returns it.
+// A selection sort is cheaper than sorting, since most searches only need a few moves.
+func (mp *MovePicker) pickBest() Move {
+	best := mp.next
+	for i := mp.next + 1; i < mp.moves.count; i++ {
+		if mp.scores[i] > mp.scores[best] {
+			best = i
+		}
+	}
+	mp.moves.moves[mp.next], mp.moves.moves[best] = mp.moves.moves[best], mp.moves.moves[mp.next]
+	mp.scores[mp.next], mp.scores[best] = mp.scores[best], mp.scores[mp.next]
+	mp.next++
+	return mp.moves.moves[mp.next-1]
+}
+
+func (mp *MovePicker) historyScore(m Move) int {
+	if mp.history == nil {
+		return 0
+	}
+	return mp.history(m)
+}
+
+// Scores a capture or promotion by most valuable victim, then least valuable attacker.
+func (b *Board) captureScore(m Move) int {
+	victim := b.pieces[m.To()]
+	if b.pieces[m.From()] == Pawn && m.To() == b.enpassant && b.enpassant != 0 {
+		victim = Pawn
+	}
+	return 16*(seePieceValues[victim]+seePieceValues[m.Promote()]) - int(b.pieces[m.From()])
+}
+
+// Returns whether a move of one of our pieces is neither a capture nor a promotion.
+func (b *Board) isQuiet(m Move) bool {
+	oppPieces := b.White.All
+	if b.Wtomove {
+		oppPieces = b.Black.All
+	}
+	to := m.To()
+	if m.Promote() != Nothing || bitSet(oppPieces, to) {
+		return false
+	}
+	return b.pieces[m.From()] != Pawn || to != b.enpassant || b.enpassant == 0
+}
@@ -0,0 +1,137 @@
+package dragontoothmg
+
+import (
+	"testing"
+)
+
+func TestMovePicker(t *testing.T) {
+	positions := []string{
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 0",
+		"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N b - - 0 1",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+		"bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9",
+		"rnbqkbnr/ppp2ppp/8/3pp3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq d6 0 3",
+	}
+	var check func(b *Board, depth int)
+	check = func(b *Board, depth int) {
+		legal := b.GenerateLegalMoves()
+		// Use moves from the previous position as stale killers, and arbitrary
+		// legal moves as the TT move, killers and counter move.
+		var quiets []Move
+		var tt Move
+		for _, m := range legal {
+			if b.isQuiet(m) {
+				quiets = append(quiets, m)
+			} else if tt == 0 {
+				tt = m
+			}
+		}
+		killers := [2]Move{0x7fff, 0}
+		var counter Move
+		if len(quiets) > 2 {
+			killers[1], counter = quiets[len(quiets)-1], quiets[len(quiets)-2]
+		}
+		history := func(m Move) int { return int(m.To()) }
+		mp := NewMovePicker(b, tt, killers, counter, history)
+		seen := map[Move]bool{}
+		stage := 0 // 0: tt, 1: good captures, 2: killer, 3: counter, 4: quiets, 5: bad captures
+		lastHistory := 1 << 30
+		for i := 0; ; i++ {
+			m, ok := mp.Next()
+			if !ok {
+				break
+			}
+			if seen[m] {
+				t.Fatal("Move", m.String(), "yielded twice in", b.ToFen())
+			}
+			seen[m] = true
+			if i == 0 && tt != 0 && m != tt {
+				t.Fatal("TT move not yielded first in", b.ToFen())
+			}
+			if m == tt || b.OurKingInCheck() {
+				continue
+			}
+			next := 0
+			switch {
+			case m == killers[1]:
+				next = 2
+			case m == counter:
+				next = 3
+			case b.isQuiet(m):
+				next = 4
+				if history(m) > lastHistory {
+					t.Fatal("Quiet move", m.String(), "out of history order in", b.ToFen())
+				}
+				lastHistory = history(m)
+			case b.SEEGreaterOrEqual(m, 0):
+				next = 1
+			default:
+				next = 5
+			}
+			if next < stage {
+				t.Fatal("Move", m.String(), "yielded out of order in", b.ToFen())
+			}
+			stage = next
+		}
+		if len(seen) != len(legal) {
+			t.Fatal("Expected", len(legal), "moves but got", len(seen), "in", b.ToFen())
+		}
+		for _, m := range legal {
+			if !seen[m] {
+				t.Fatal("Move", m.String(), "not yielded in", b.ToFen())
+			}
+		}
+		if depth > 1 {
+			for _, m := range legal {
+				unapply := b.Apply(m)
+				check(b, depth-1)
+				unapply()
+			}
+		}
+	}
+	for _, fen := range positions {
+		b := parseFenAndValidate(t, fen)
+		check(&b, 3)
+	}
+}
+
+func TestMovePickerOrder(t *testing.T) {
+	move := func(s string) Move {
+		m, _ := ParseMove(s)
+		return m
+	}
+	// The knight can win a rook, or lose itself or the queen for a pawn.
+	b := parseFenAndValidate(t, "4k3/8/4p3/1r1p4/8/2N5/8/3QK3 w - - 0 1")
+	killers := [2]Move{move("e1e2"), move("a7a8")}
+	mp := NewMovePicker(&b, move("e1f2"), killers, move("c3b1"), nil)
+	var got []string
+	for m, ok := mp.Next(); ok; m, ok = mp.Next() {
+		got = append(got, m.String())
+	}
+	if len(got) != len(b.GenerateLegalMoves()) {
+		t.Fatal("Wrong number of moves:", got)
+	}
+	expected := []string{"e1f2", "c3b5", "e1e2", "c3b1"}
+	for i, s := range expected {
+		if got[i] != s {
+			t.Fatal("Expected", expected, "first but got", got)
+		}
+	}
+	if got[len(got)-2] != "c3d5" || got[len(got)-1] != "d1d5" {
+		t.Fatal("Expected the losing captures last but got", got)
+	}
+}
+
+func TestMovePickerDoesNotAllocate(t *testing.T) {
+	b := parseFenAndValidate(t, "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	var mp MovePicker
+	allocs := testing.AllocsPerRun(100, func() {
+		mp.Init(&b, 0, [2]Move{}, 0, nil)
+		for _, ok := mp.Next(); ok; _, ok = mp.Next() {
+		}
+	})
+	if allocs != 0 {
+		t.Error("Picking moves allocated", allocs, "times")
+	}
+}
@@ -1,6 +1,11 @@
 package dragontoothmg
 
-import "fmt"
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
 
 // Run perft to count the number of moves.
 // Useful for testing and benchmarking.
@@ -8,12 +13,13 @@ func Perft(b *Board, n int) int64 {
 	if n <= 0 {
 		return 1
 	}
-	moves := b.GenerateLegalMoves()
 	if n == 1 {
-		return int64(len(moves))
+		return int64(b.CountLegalMoves())
 	}
+	var moves MoveList
+	b.GenerateLegalMovesInto(&moves, GenAll)
 	var count int64 = 0
-	for _, move := range moves {
+	for _, move := range moves.Slice() {
 		unapply := b.Apply(move)
 		count += Perft(b, n-1)
 		unapply()
@@ -22,12 +28,120 @@ func Perft(b *Board, n int) int64 {
 }
 
 // Performs the Perft move count division operation. Useful for debugging.
+// Prints the count for each legal move, in the order the moves are generated.
 func Divide(b *Board, n int) {
+	results := DivideResult(b, n)
+	for _, move := range b.GenerateLegalMoves() {
+		fmt.Printf( /*"Move   #%3d:   "*/ "%-6s =%9d\n" /*i+1, */, &move, results[move.Base()])
+	}
+}
+
+// Performs the Perft move count division operation, returning the number of
+// positions at depth n reached through each legal move. The map is keyed by
+// Move.Base, so it can be indexed by a move from ParseMove.
+func DivideResult(b *Board, n int) map[Move]int64 {
 	moves := b.GenerateLegalMoves()
+	results := make(map[Move]int64, len(moves))
 	for _, move := range moves {
 		unapply := b.Apply(move)
-		result := Perft(b, n-1)
+		results[move.Base()] = Perft(b, n-1)
+		unapply()
+	}
+	return results
+}
+
+// Run perft on several goroutines, caching the counts of transposed subtrees.
+// The root moves are shared between the workers, each of which searches its own
+// copy of the board. If workers is not positive, one worker is used per CPU.
+// Counts are cached in a table of ttSizeMB megabytes, which is shared by the
+// workers without locking; no table is used if ttSizeMB is not positive.
+func PerftParallel(b *Board, n int, workers int, ttSizeMB int) int64 {
+	if n <= 1 {
+		return Perft(b, n)
+	}
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	tt := newPerftTable(ttSizeMB)
+	moves := b.GenerateLegalMoves()
+	var next int64 = -1 // index of the last root move taken by a worker
+	var count int64
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				j := atomic.AddInt64(&next, 1)
+				if j >= int64(len(moves)) {
+					return
+				}
+				board := *b
+				board.Apply(moves[j])
+				atomic.AddInt64(&count, perftCached(&board, n-1, tt))
+			}
+		}()
+	}
+	wg.Wait()
+	return count
+}
+
+// Run perft, looking up and storing the counts of subtrees in tt (which may be nil).
+func perftCached(b *Board, n int, tt *perftTable) int64 {
+	if n <= 1 || tt == nil {
+		return Perft(b, n)
+	}
+	if count, ok := tt.probe(b.hash, n); ok {
+		return count
+	}
+	var moves MoveList
+	b.GenerateLegalMovesInto(&moves, GenAll)
+	var count int64 = 0
+	for _, move := range moves.Slice() {
+		unapply := b.Apply(move)
+		count += perftCached(b, n-1, tt)
 		unapply()
-		fmt.Printf( /*"Move   #%3d:   "*/ "%-6s =%9d\n" /*i+1, */, &move, result)
 	}
+	tt.store(b.hash, n, count)
+	return count
+}
+
+// A hash table of perft counts by position and depth, shared between goroutines
+// without locks. Each entry holds its data xored with its key, so an entry whose
+// two words were written by different goroutines is seen as a miss.
+type perftTable struct {
+	entries []perftEntry
+	mask    uint64
+}
+
+type perftEntry struct {
+	check uint64 // the hash xored with the data
+	data  uint64 // the count in the high 56 bits, and the depth in the low 8
+}
+
+func newPerftTable(sizeMB int) *perftTable {
+	if sizeMB <= 0 {
+		return nil
+	}
+	size := uint64(1)
+	for size*2*16 <= uint64(sizeMB)<<20 { // the largest power of two that fits
+		size *= 2
+	}
+	return &perftTable{entries: make([]perftEntry, size), mask: size - 1}
+}
+
+func (t *perftTable) probe(hash uint64, depth int) (int64, bool) {
+	e := &t.entries[hash&t.mask]
+	data := atomic.LoadUint64(&e.data)
+	if atomic.LoadUint64(&e.check)^data != hash || int(data&0xff) != depth {
+		return 0, false
+	}
+	return int64(data >> 8), true
+}
+
+func (t *perftTable) store(hash uint64, depth int, count int64) {
+	e := &t.entries[hash&t.mask]
+	data := uint64(count)<<8 | uint64(depth)
+	atomic.StoreUint64(&e.check, hash^data)
+	atomic.StoreUint64(&e.data, data)
 }
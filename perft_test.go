@@ -13,6 +13,22 @@ func testDivide(t *testing.T) {
 	Divide(&b, 1)
 }
 
+func TestDivideResult(t *testing.T) {
+	b := parseFenAndValidate(t, "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0")
+	results := DivideResult(&b, 3)
+	if len(results) != 48 {
+		t.Error("Expected 48 moves in the divide, got", len(results))
+	}
+	var total int64
+	for _, count := range results {
+		total += count
+	}
+	castle := parseMove("e1g1")
+	if total != 97862 || results[castle] != 2059 {
+		t.Error("Wrong divide results:", total, results[castle])
+	}
+}
+
 // Uncomment lines in the solution maps for more thorough testing, although this takes longer
 func TestMate(t *testing.T) {
 	perftSolutions := map[int]int64{
@@ -118,6 +134,24 @@ func TestPromotions(t *testing.T) {
 	checkPerftResults(pos, perftSolutions, t)
 }
 
+// Chess960 positions, with castling rights in Shredder-FEN
+func TestChess960(t *testing.T) {
+	positions := map[string]map[int]int64{
+		"bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9": {
+			1: 21, 2: 528, 3: 12189, 4: 326672,
+		},
+		"2nnrbkr/p1qppppp/8/1ppb4/6PP/3PP3/PPP2P2/BQNNRBKR w HEhe - 1 9": {
+			1: 21, 2: 807, 3: 18002, 4: 667366,
+		},
+		"b1q1rrkb/pppppppp/3nn3/8/P7/1PPP4/4PPPP/BQNNRKRB w GE - 1 9": {
+			1: 20, 2: 479, 3: 10471, 4: 273318,
+		},
+	}
+	for pos, perftSolutions := range positions {
+		checkPerftResults(pos, perftSolutions, t)
+	}
+}
+
 func checkPerftResults(fen string, perftSolutions map[int]int64, t *testing.T) {
 	b := parseFenAndValidate(t, fen)
 	for i := 1; i <= len(perftSolutions); i++ {
@@ -133,3 +167,70 @@ func checkPerftResults(fen string, perftSolutions map[int]int64, t *testing.T) {
 		}
 	}
 }
+
+func TestPerftParallel(t *testing.T) {
+	positions := map[string]map[int]int64{
+		Startpos: {5: 4865609},
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0": {1: 48, 4: 4085603},
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 0":                            {6: 11030083},
+		"bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9":    {4: 326672},
+	}
+	for fen, solutions := range positions {
+		for depth, expected := range solutions {
+			// With no table, a table small enough to overwrite entries, and a larger one.
+			for _, ttSizeMB := range []int{0, 1, 16} {
+				b := parseFenAndValidate(t, fen)
+				before := b.ToFen()
+				if result := PerftParallel(&b, depth, 4, ttSizeMB); result != expected {
+					t.Error("Parallel perft error in position\n", fen, "\nExpected",
+						expected, "but got", result, "for depth", depth, "and table size", ttSizeMB)
+				}
+				if b.ToFen() != before {
+					t.Error("Parallel perft corrupted board state.")
+				}
+			}
+		}
+	}
+}
+
+// Counts positions like Perft, by filtering pseudo-legal moves through IsLegal.
+func perftPseudoLegal(b *Board, n int) int64 {
+	if n == 0 {
+		return 1
+	}
+	var moves MoveList
+	b.GeneratePseudoLegalMovesInto(&moves)
+	var count int64
+	for _, move := range moves.Slice() {
+		if !b.IsLegal(move) {
+			continue
+		}
+		unapply := b.Apply(move)
+		count += perftPseudoLegal(b, n-1)
+		unapply()
+	}
+	return count
+}
+
+func TestPseudoLegalPerft(t *testing.T) {
+	positions := map[string]map[int]int64{
+		Startpos: {4: 197281},
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0": {4: 4085603},
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 0":                            {5: 674624},
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1":     {4: 422333},
+		"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8":            {4: 2103487},
+		"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N b - - 0 1":                              {4: 182838},
+		"5k1R/5p2/5P2/8/8/2r5/2rR2K1/4B3 b - - 0 1":                            {3: 0},
+		"bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9":    {4: 326672},
+		"2nnrbkr/p1qppppp/8/1ppb4/6PP/3PP3/PPP2P2/BQNNRBKR w HEhe - 1 9":       {4: 667366},
+	}
+	for fen, solutions := range positions {
+		for depth, expected := range solutions {
+			b := parseFenAndValidate(t, fen)
+			if result := perftPseudoLegal(&b, depth); result != expected {
+				t.Error("Pseudo-legal perft error in position\n", fen, "\nExpected",
+					expected, "but got", result, "for depth", depth)
+			}
+		}
+	}
+}
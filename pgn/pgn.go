@@ -0,0 +1,91 @@
+// pgn reads and writes chess games in Portable Game Notation, using dragontoothmg
+// to replay and validate every move.
+package pgn
+
+import (
+	"github.com/dylhunn/dragontoothmg"
+)
+
+// A single PGN tag pair, such as [White "Carlsen, Magnus"].
+type Tag struct {
+	Name  string
+	Value string
+}
+
+// A move in the game tree, along with its annotations.
+type Node struct {
+	Move    dragontoothmg.Move
+	NAGs    []int  // Numeric Annotation Glyphs; suffixes like "!?" are stored as their NAG
+	Comment string // The comment following the move, if any
+	// A comment preceding the move. Only used for the first move of a variation;
+	// elsewhere, such comments belong to the previous move (or to the Game).
+	CommentBefore string
+	// Alternatives to this move, each played from the position before this move.
+	Variations [][]*Node
+}
+
+// A single game: its tag pairs, movetext tree, and result.
+type Game struct {
+	Tags    []Tag   // In the order they were read
+	Comment string  // A comment preceding the first move, if any
+	Moves   []*Node // The mainline
+	Result  string  // One of "1-0", "0-1", "1/2-1/2", or "*"
+}
+
+// The tags that must be exported first, in this order.
+var sevenTagRoster = []string{"Event", "Site", "Date", "Round", "White", "Black", "Result"}
+
+// Returns the value of the named tag, or "" if the game does not have it.
+func (g *Game) Tag(name string) string {
+	for _, tag := range g.Tags {
+		if tag.Name == name {
+			return tag.Value
+		}
+	}
+	return ""
+}
+
+// Sets the value of the named tag, adding it if it does not exist.
+func (g *Game) SetTag(name, value string) {
+	for i := range g.Tags {
+		if g.Tags[i].Name == name {
+			g.Tags[i].Value = value
+			return
+		}
+	}
+	g.Tags = append(g.Tags, Tag{name, value})
+}
+
+// Returns the position the game starts from: the FEN tag if there is one,
+// and the standard starting position otherwise.
+func (g *Game) StartingPosition() (dragontoothmg.Board, error) {
+	if fen := g.Tag("FEN"); fen != "" {
+		return dragontoothmg.ParseFenStrict(fen)
+	}
+	return dragontoothmg.ParseFen(dragontoothmg.Startpos), nil
+}
+
+// Returns the moves of the mainline, without annotations.
+func (g *Game) Mainline() []dragontoothmg.Move {
+	moves := make([]dragontoothmg.Move, len(g.Moves))
+	for i, node := range g.Moves {
+		moves[i] = node.Move
+	}
+	return moves
+}
+
+// Returns the position at the end of the mainline.
+func (g *Game) FinalPosition() (dragontoothmg.Board, error) {
+	b, err := g.StartingPosition()
+	if err != nil {
+		return b, err
+	}
+	for _, node := range g.Moves {
+		b.Apply(node.Move)
+	}
+	return b, nil
+}
+
+func isResult(token string) bool {
+	return token == "1-0" || token == "0-1" || token == "1/2-1/2" || token == "*"
+}
@@ -0,0 +1,177 @@
+package pgn
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/dylhunn/dragontoothmg"
+)
+
+const fischerSpassky = `[Event "F/S Return Match"]
+[Site "Belgrade, Serbia JUG"]
+[Date "1992.11.04"]
+[Round "29"]
+[White "Fischer, Robert J."]
+[Black "Spassky, Boris V."]
+[Result "1/2-1/2"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bb5 a6 {This opening is called the Ruy Lopez.}
+4. Ba4 Nf6 5. O-O Be7 6. Re1 b5 7. Bb3 d6 8. c3 O-O 9. h3 Nb8 10. d4 Nbd7
+11. c4 c6 12. cxb5 axb5 13. Nc3 Bb7 14. Bg5 b4 15. Nb1 h6 16. Bh4 c5 17. dxe5
+Nxe4 18. Bxe7 Qxe7 19. exd6 Qf6 20. Nbd2 Nxd6 21. Nc4 Nxc4 22. Bxc4 Nb6
+23. Ne5 Rae8 24. Bxf7+ Rxf7 25. Nxf7 Rxe1+ 26. Qxe1 Kxf7 27. Qe3 Qg5 28. Qxg5
+hxg5 29. b3 Ke6 30. a3 Kd6 31. axb4 cxb4 32. Ra5 Nd5 33. f3 Bc8 34. Kf2 Bf5
+35. Ra7 g6 36. Ra6+ Kc5 37. Ke1 Nf4 38. g3 Nxh3 39. Kd2 Kb5 40. Rd6 Kc5 41. Ra6
+Nf2 42. g4 Bd3 43. Re6 1/2-1/2
+`
+
+func TestReadGame(t *testing.T) {
+	games, err := ReadAll(strings.NewReader(fischerSpassky))
+	if err != nil || len(games) != 1 {
+		t.Fatal("Failed to read game:", err)
+	}
+	g := games[0]
+	if g.Tag("White") != "Fischer, Robert J." || g.Tag("Round") != "29" || g.Tag("Missing") != "" {
+		t.Error("Tags parsed incorrectly:", g.Tags)
+	}
+	if g.Result != "1/2-1/2" {
+		t.Error("Wrong result:", g.Result)
+	}
+	if len(g.Moves) != 85 {
+		t.Error("Expected 85 moves but got", len(g.Moves))
+	}
+	if g.Moves[5].Comment != "This opening is called the Ruy Lopez." {
+		t.Error("Comment attached to the wrong move:", g.Moves[5].Comment)
+	}
+	final, _ := g.FinalPosition()
+	if fen := final.ToFen(); fen != "8/8/4R1p1/2k3p1/1p4P1/1P1b1P2/3K1n2/8 b - - 2 43" {
+		t.Error("Wrong final position:", fen)
+	}
+}
+
+func TestReadAnnotations(t *testing.T) {
+	text := `[Event "Annotated"]
+[SetUp "1"]
+[FEN "4k3/8/8/8/8/8/4P3/4K3 w - - 0 1"]
+
+; a rest-of-line comment
+{Pre-game} 1. e4!? $14 (1. e3 {Slower} (1. Kd2) 1... Kd7) (1. Kf2) 1... Ke7 2. Kd2? *
+%this line is ignored
+[Event "Second"]
+
+1. d4 d5 1-0`
+	games, err := ReadAll(strings.NewReader(text))
+	if err != nil || len(games) != 2 {
+		t.Fatal("Failed to read games:", err, len(games))
+	}
+	g := games[0]
+	if g.Comment != "a rest-of-line comment Pre-game" {
+		t.Error("Wrong game comment:", g.Comment)
+	}
+	if len(g.Moves) != 3 || g.Result != "*" {
+		t.Fatal("Wrong mainline:", g.Mainline(), g.Result)
+	}
+	first := g.Moves[0]
+	if len(first.NAGs) != 2 || first.NAGs[0] != 5 || first.NAGs[1] != 14 {
+		t.Error("Wrong NAGs:", first.NAGs)
+	}
+	if len(first.Variations) != 2 || len(first.Variations[0]) != 2 || len(first.Variations[1]) != 1 {
+		t.Fatal("Wrong variations:", first.Variations)
+	}
+	if first.Variations[0][0].Comment != "Slower" || len(first.Variations[0][0].Variations) != 1 {
+		t.Error("Wrong nested variation")
+	}
+	if len(g.Moves[2].NAGs) != 1 || g.Moves[2].NAGs[0] != 2 {
+		t.Error("Wrong suffix annotation:", g.Moves[2].NAGs)
+	}
+	if games[1].Tag("Event") != "Second" || len(games[1].Moves) != 2 || games[1].Result != "1-0" {
+		t.Error("Wrong second game")
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	text := `[Event "Bad"]
+
+1. e4 e5 2. Ke3 Nc6 1-0
+
+[Event "Good"]
+
+1. e4 *`
+	r := NewReader(strings.NewReader(text))
+	if _, err := r.Next(); err == nil {
+		t.Error("Expected an illegal move error")
+	}
+	g, err := r.Next()
+	if err != nil || g.Tag("Event") != "Good" || len(g.Moves) != 1 {
+		t.Error("Failed to recover after a malformed game:", err)
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Error("Expected EOF, got", err)
+	}
+	malformed := []string{"[FEN \"8/8/8 w - - 0 1\"] 1. e4", "1. e4 (e5", "1. e4 e5)", "1. e4 ( ) [Event", "(1. e4)", "[Event Bad] 1. e4"}
+	for _, text := range malformed {
+		if _, err := ReadAll(strings.NewReader(text)); err == nil {
+			t.Error("Expected an error reading", text)
+		}
+	}
+}
+
+func TestWriteGame(t *testing.T) {
+	g := &Game{Result: "1-0"}
+	g.SetTag("White", "Alice")
+	g.SetTag("ECO", "C20")
+	b := dragontoothmg.ParseFen(dragontoothmg.Startpos)
+	var nodes []*Node
+	for _, san := range []string{"e4", "e5", "Qh5", "Nc6", "Bc4", "Nf6", "Qxf7#"} {
+		m, err := b.ParseSAN(san)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Apply(m)
+		nodes = append(nodes, &Node{Move: m})
+	}
+	g.Moves = nodes
+	g.Moves[3].Comment = "Defends e5"
+	alt := dragontoothmg.ParseFen("rnbqkbnr/pppp1ppp/8/4p2Q/4P3/8/PPPP1PPP/RNB1KBNR b KQkq - 1 2")
+	m, _ := alt.ParseSAN("g6")
+	g.Moves[3].Variations = [][]*Node{{&Node{Move: m, NAGs: []int{2}}}}
+	expected := `[Event "?"]
+[Site "?"]
+[Date "?"]
+[Round "?"]
+[White "Alice"]
+[Black "?"]
+[Result "1-0"]
+[ECO "C20"]
+
+1. e4 e5 2. Qh5 Nc6 {Defends e5} (2... g6 $2) 3. Bc4 Nf6 4. Qxf7# 1-0
+
+`
+	if g.String() != expected {
+		t.Error("Wrong PGN output:\n" + g.String())
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	games, err := ReadAll(strings.NewReader(fischerSpassky))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sb strings.Builder
+	if err := Write(&sb, games[0]); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(sb.String(), "\n") {
+		if len(line) > maxLineLength {
+			t.Error("Line too long:", line)
+		}
+	}
+	reread, err := ReadAll(strings.NewReader(sb.String()))
+	if err != nil || len(reread) != 1 {
+		t.Fatal("Failed to reread game:", err)
+	}
+	if reread[0].String() != sb.String() {
+		t.Error("Round trip changed the game:\n" + reread[0].String())
+	}
+}
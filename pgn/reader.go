@@ -0,0 +1,345 @@
+package pgn
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dylhunn/dragontoothmg"
+)
+
+type tokenKind int
+
+const (
+	tokEOF     tokenKind = iota
+	tokSymbol            // SAN moves, results and tag names
+	tokNumber            // move numbers, which are ignored
+	tokString            // tag values
+	tokComment           // the contents of {...} or ;... comments
+	tokNAG               // $n, or a suffix annotation like "!?"
+	tokLBracket
+	tokRBracket
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	line int
+}
+
+// Suffix annotations, and the NAGs they are equivalent to.
+var suffixNAGs = map[string]int{"!": 1, "?": 2, "!!": 3, "??": 4, "!?": 5, "?!": 6}
+
+// Reads a sequence of games from a PGN stream.
+type Reader struct {
+	r               *bufio.Reader
+	line            int
+	atLineStart     bool
+	prevAtLineStart bool // restored by unreadRune
+	peeked          *token
+}
+
+// Creates a Reader that parses games from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r), line: 1, atLineStart: true}
+}
+
+// Reads all the games in r. Stops at the first malformed game.
+func ReadAll(r io.Reader) ([]*Game, error) {
+	var games []*Game
+	reader := NewReader(r)
+	for {
+		game, err := reader.Next()
+		if err == io.EOF {
+			return games, nil
+		}
+		if err != nil {
+			return games, err
+		}
+		games = append(games, game)
+	}
+}
+
+// Parses and returns the next game, replaying every move (including variations)
+// to check its legality. Returns io.EOF when there are no more games.
+// If a game is malformed, the rest of it is skipped and an error is returned;
+// Next can then be called again to continue with the following game.
+func (r *Reader) Next() (*Game, error) {
+	var g Game
+	for r.peek().kind == tokLBracket {
+		if err := r.readTag(&g); err != nil {
+			r.skipGame()
+			return nil, err
+		}
+	}
+	if len(g.Tags) == 0 && r.peek().kind == tokEOF {
+		return nil, io.EOF
+	}
+	g.Result = g.Tag("Result")
+	start, err := g.StartingPosition()
+	if err != nil {
+		r.skipGame()
+		return nil, err
+	}
+	moves, err := r.readLine(&g, start, 0)
+	if err != nil {
+		r.skipGame()
+		return nil, err
+	}
+	g.Moves = moves
+	if g.Result == "" {
+		g.Result = "*"
+	}
+	return &g, nil
+}
+
+// Reads a tag pair, such as [Event "F/S Return Match"].
+func (r *Reader) readTag(g *Game) error {
+	r.next() // the '['
+	name, value, end := r.next(), r.next(), r.next()
+	if name.kind != tokSymbol || value.kind != tokString || end.kind != tokRBracket {
+		return fmt.Errorf("Malformed tag pair on line %d", name.line)
+	}
+	g.Tags = append(g.Tags, Tag{name.text, value.text})
+	return nil
+}
+
+// Reads a sequence of moves, starting from b, until the end of the variation
+// (at depth > 0) or the game (at depth 0).
+func (r *Reader) readLine(g *Game, b dragontoothmg.Board, depth int) ([]*Node, error) {
+	var nodes []*Node
+	var before dragontoothmg.Board // the position before the last move
+	var pendingComment string      // a comment preceding the first move of a variation
+	for {
+		tok := r.next()
+		switch tok.kind {
+		case tokEOF:
+			if depth > 0 {
+				return nil, errors.New("Unterminated variation at end of input")
+			}
+			return nodes, nil
+		case tokLBracket:
+			if depth > 0 {
+				return nil, fmt.Errorf("Unexpected tag pair on line %d", tok.line)
+			}
+			r.peeked = &tok // a new game begins without a result token
+			return nodes, nil
+		case tokRParen:
+			if depth == 0 {
+				return nil, fmt.Errorf("Unmatched ')' on line %d", tok.line)
+			}
+			return nodes, nil
+		case tokLParen:
+			if len(nodes) == 0 {
+				return nil, fmt.Errorf("Variation without a preceding move on line %d", tok.line)
+			}
+			variation, err := r.readLine(g, before, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			last := nodes[len(nodes)-1]
+			last.Variations = append(last.Variations, variation)
+		case tokComment:
+			if len(nodes) > 0 {
+				nodes[len(nodes)-1].Comment = joinComments(nodes[len(nodes)-1].Comment, tok.text)
+			} else if depth == 0 {
+				g.Comment = joinComments(g.Comment, tok.text)
+			} else {
+				pendingComment = joinComments(pendingComment, tok.text)
+			}
+		case tokNAG:
+			if len(nodes) == 0 {
+				return nil, fmt.Errorf("Annotation without a preceding move on line %d", tok.line)
+			}
+			var nag int
+			if n, ok := suffixNAGs[tok.text]; ok {
+				nag = n
+			} else if _, err := fmt.Sscanf(tok.text, "$%d", &nag); err != nil {
+				return nil, fmt.Errorf("Invalid annotation %q on line %d", tok.text, tok.line)
+			}
+			nodes[len(nodes)-1].NAGs = append(nodes[len(nodes)-1].NAGs, nag)
+		case tokNumber:
+			// Move numbers are implied by the position, so they are ignored.
+		case tokString, tokRBracket:
+			return nil, fmt.Errorf("Unexpected %q on line %d", tok.text, tok.line)
+		case tokSymbol:
+			if isResult(tok.text) {
+				if depth > 0 {
+					return nil, fmt.Errorf("Result inside a variation on line %d", tok.line)
+				}
+				g.Result = tok.text
+				return nodes, nil
+			}
+			m, err := b.ParseSAN(tok.text)
+			if err != nil {
+				return nil, fmt.Errorf("Line %d: %v", tok.line, err)
+			}
+			before = b
+			b.Apply(m)
+			nodes = append(nodes, &Node{Move: m, CommentBefore: pendingComment})
+			pendingComment = ""
+		}
+	}
+}
+
+func joinComments(a, b string) string {
+	if a == "" {
+		return b
+	}
+	return a + " " + b
+}
+
+// Discards tokens up to and including the end of the current game.
+func (r *Reader) skipGame() {
+	for {
+		tok := r.next()
+		switch {
+		case tok.kind == tokEOF:
+			return
+		case tok.kind == tokLBracket: // the next game's tags
+			r.peeked = &tok
+			return
+		case tok.kind == tokSymbol && isResult(tok.text):
+			return
+		}
+	}
+}
+
+func (r *Reader) peek() token {
+	if r.peeked == nil {
+		tok := r.lex()
+		r.peeked = &tok
+	}
+	return *r.peeked
+}
+
+func (r *Reader) next() token {
+	tok := r.peek()
+	r.peeked = nil
+	return tok
+}
+
+func (r *Reader) readRune() (rune, bool) {
+	c, _, err := r.r.ReadRune()
+	if err != nil {
+		return 0, false
+	}
+	r.prevAtLineStart, r.atLineStart = r.atLineStart, c == '\n'
+	if c == '\n' {
+		r.line++
+	}
+	return c, true
+}
+
+func (r *Reader) unreadRune(c rune) {
+	r.r.UnreadRune()
+	r.atLineStart = r.prevAtLineStart
+	if c == '\n' {
+		r.line--
+	}
+}
+
+// Reads runes until the end of the line (exclusive) and returns them.
+func (r *Reader) readToEndOfLine() string {
+	var sb strings.Builder
+	for {
+		c, ok := r.readRune()
+		if !ok || c == '\n' {
+			return sb.String()
+		}
+		sb.WriteRune(c)
+	}
+}
+
+func isSymbolRune(c rune) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') ||
+		strings.ContainsRune("_+#=:-/", c)
+}
+
+// Produces the next token from the input.
+func (r *Reader) lex() token {
+	for {
+		lineStart := r.atLineStart
+		c, ok := r.readRune()
+		if !ok {
+			return token{kind: tokEOF, line: r.line}
+		}
+		line := r.line
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '.':
+			continue
+		case c == '%' && lineStart: // escape mechanism: ignore the whole line
+			r.readToEndOfLine()
+			continue
+		case c == ';':
+			return token{tokComment, strings.TrimSpace(r.readToEndOfLine()), line}
+		case c == '{':
+			var sb strings.Builder
+			for {
+				c, ok := r.readRune()
+				if !ok || c == '}' {
+					break
+				}
+				sb.WriteRune(c)
+			}
+			return token{tokComment, strings.Join(strings.Fields(sb.String()), " "), line}
+		case c == '"':
+			var sb strings.Builder
+			for {
+				c, ok := r.readRune()
+				if !ok || c == '"' {
+					break
+				}
+				if c == '\\' {
+					if c, ok = r.readRune(); !ok {
+						break
+					}
+				}
+				sb.WriteRune(c)
+			}
+			return token{tokString, sb.String(), line}
+		case c == '[':
+			return token{tokLBracket, "[", line}
+		case c == ']':
+			return token{tokRBracket, "]", line}
+		case c == '(':
+			return token{tokLParen, "(", line}
+		case c == ')':
+			return token{tokRParen, ")", line}
+		case c == '*':
+			return token{tokSymbol, "*", line}
+		case c == '$':
+			return token{tokNAG, "$" + r.readWhile(func(c rune) bool { return c >= '0' && c <= '9' }), line}
+		case c == '!' || c == '?':
+			return token{tokNAG, string(c) + r.readWhile(func(c rune) bool { return c == '!' || c == '?' }), line}
+		case isSymbolRune(c):
+			text := string(c) + r.readWhile(isSymbolRune)
+			if strings.Trim(text, "0123456789") == "" {
+				return token{tokNumber, text, line}
+			}
+			return token{tokSymbol, text, line}
+		default:
+			return token{tokSymbol, string(c), line}
+		}
+	}
+}
+
+// Reads runes while they satisfy pred, and returns them.
+func (r *Reader) readWhile(pred func(rune) bool) string {
+	var sb strings.Builder
+	for {
+		c, ok := r.readRune()
+		if !ok {
+			return sb.String()
+		}
+		if !pred(c) {
+			r.unreadRune(c)
+			return sb.String()
+		}
+		sb.WriteRune(c)
+	}
+}
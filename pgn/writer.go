@@ -0,0 +1,151 @@
+package pgn
+
+import (
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/dylhunn/dragontoothmg"
+)
+
+// The maximum length of an exported movetext line, as recommended by the PGN standard.
+const maxLineLength = 79
+
+// Writes the game in PGN export format: the Seven Tag Roster first, then any other
+// tags, then the movetext (wrapped to 79 columns), followed by a blank line.
+func Write(w io.Writer, g *Game) error {
+	text, err := g.export()
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, text)
+	return err
+}
+
+// Returns the game in PGN export format.
+// If the FEN tag is invalid, the moves are omitted.
+func (g *Game) String() string {
+	text, _ := g.export()
+	return text
+}
+
+func (g *Game) export() (string, error) {
+	start, err := g.StartingPosition()
+	var sb strings.Builder
+	for _, name := range sevenTagRoster {
+		value := g.Tag(name)
+		if name == "Result" {
+			value = g.result()
+		} else if value == "" {
+			value = "?"
+		}
+		writeTag(&sb, name, value)
+	}
+	for _, tag := range g.Tags {
+		if !isSevenTagRoster(tag.Name) {
+			writeTag(&sb, tag.Name, tag.Value)
+		}
+	}
+	sb.WriteString("\n")
+
+	var tokens []string
+	if g.Comment != "" {
+		tokens = append(tokens, commentTokens(g.Comment)...)
+	}
+	if err == nil {
+		tokens = appendLine(tokens, start, g.Moves)
+	}
+	tokens = append(tokens, g.result())
+
+	lineLength := 0
+	for _, tok := range tokens {
+		if lineLength > 0 && lineLength+1+len(tok) > maxLineLength {
+			sb.WriteString("\n")
+			lineLength = 0
+		}
+		if lineLength > 0 {
+			sb.WriteString(" ")
+			lineLength++
+		}
+		sb.WriteString(tok)
+		lineLength += len(tok)
+	}
+	sb.WriteString("\n\n")
+	return sb.String(), err
+}
+
+func (g *Game) result() string {
+	if isResult(g.Result) {
+		return g.Result
+	}
+	return "*"
+}
+
+func isSevenTagRoster(name string) bool {
+	for _, str := range sevenTagRoster {
+		if str == name {
+			return true
+		}
+	}
+	return false
+}
+
+func writeTag(sb *strings.Builder, name, value string) {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, `"`, `\"`, -1)
+	sb.WriteString("[" + name + " \"" + value + "\"]\n")
+}
+
+// Splits a comment into words, so that it can be wrapped across lines.
+func commentTokens(comment string) []string {
+	words := strings.Fields("{" + comment + "}")
+	if len(words) == 1 && words[0] == "{}" {
+		return words
+	}
+	if words[0] == "{" { // the comment began with whitespace
+		words = words[1:]
+		words[0] = "{" + words[0]
+	}
+	if words[len(words)-1] == "}" {
+		words = words[:len(words)-1]
+		words[len(words)-1] += "}"
+	}
+	return words
+}
+
+// Appends the movetext tokens for a sequence of moves played from b.
+func appendLine(tokens []string, b dragontoothmg.Board, nodes []*Node) []string {
+	needNumber := true
+	for _, node := range nodes {
+		if node.CommentBefore != "" {
+			tokens = append(tokens, commentTokens(node.CommentBefore)...)
+		}
+		if b.Wtomove {
+			tokens = append(tokens, strconv.Itoa(int(b.Fullmoveno))+".")
+		} else if needNumber {
+			tokens = append(tokens, strconv.Itoa(int(b.Fullmoveno))+"...")
+		}
+		needNumber = false
+
+		tokens = append(tokens, b.MoveToSAN(node.Move))
+		for _, nag := range node.NAGs {
+			tokens = append(tokens, "$"+strconv.Itoa(nag))
+		}
+		if node.Comment != "" {
+			tokens = append(tokens, commentTokens(node.Comment)...)
+			needNumber = true
+		}
+		for _, variation := range node.Variations {
+			if len(variation) == 0 {
+				continue
+			}
+			start := len(tokens)
+			tokens = appendLine(tokens, b, variation)
+			tokens[start] = "(" + tokens[start]
+			tokens[len(tokens)-1] += ")"
+			needNumber = true
+		}
+		b.Apply(node.Move)
+	}
+	return tokens
+}
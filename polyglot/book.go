@@ -0,0 +1,162 @@
+package polyglot
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+
+	"github.com/dylhunn/dragontoothmg"
+)
+
+// The size in bytes of a book entry.
+const entrySize = 16
+
+// A single book entry, as stored in a .bin file.
+type Entry struct {
+	Key    uint64
+	Move   uint16 // encoded as described in DecodeMove
+	Weight uint16
+	Learn  uint32
+}
+
+// A book move, decoded for a particular position.
+type BookMove struct {
+	Move   dragontoothmg.Move
+	Weight uint16
+}
+
+// A Polyglot opening book. Entries are read on demand, so books of any size can be
+// used without loading them into memory. A Book is safe for concurrent use if its
+// underlying reader is.
+type Book struct {
+	r     io.ReaderAt
+	count int64
+	file  *os.File // if opened by Open
+}
+
+// Opens the Polyglot book at the given path. The book should be closed after use.
+func Open(path string) (*Book, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	book, err := NewBook(f, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	book.file = f
+	return book, nil
+}
+
+// Creates a book that reads size bytes of entries from r, which must be sorted by key
+// as in a .bin file.
+func NewBook(r io.ReaderAt, size int64) (*Book, error) {
+	if size%entrySize != 0 {
+		return nil, errors.New("Invalid Polyglot book: size is not a multiple of 16 bytes")
+	}
+	return &Book{r: r, count: size / entrySize}, nil
+}
+
+// Closes the file of a book created with Open. Does nothing for other books.
+func (bk *Book) Close() error {
+	if bk.file == nil {
+		return nil
+	}
+	return bk.file.Close()
+}
+
+func (bk *Book) entry(i int64) (Entry, error) {
+	var buf [entrySize]byte
+	if _, err := bk.r.ReadAt(buf[:], i*entrySize); err != nil {
+		return Entry{}, err
+	}
+	return Entry{
+		Key:    binary.BigEndian.Uint64(buf[0:8]),
+		Move:   binary.BigEndian.Uint16(buf[8:10]),
+		Weight: binary.BigEndian.Uint16(buf[10:12]),
+		Learn:  binary.BigEndian.Uint32(buf[12:16]),
+	}, nil
+}
+
+// Returns all the entries with the given key, in the order they appear in the book.
+func (bk *Book) Entries(key uint64) ([]Entry, error) {
+	var err error
+	first := int64(sort.Search(int(bk.count), func(i int) bool {
+		if err != nil {
+			return true
+		}
+		var e Entry
+		e, err = bk.entry(int64(i))
+		return e.Key >= key
+	}))
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for i := first; i < bk.count; i++ {
+		e, err := bk.entry(i)
+		if err != nil {
+			return nil, err
+		}
+		if e.Key != key {
+			break
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// Returns the book moves for a position. Entries whose moves are illegal in the
+// position are skipped.
+func (bk *Book) Moves(b *dragontoothmg.Board) ([]BookMove, error) {
+	entries, err := bk.Entries(Key(b))
+	if err != nil {
+		return nil, err
+	}
+	var moves []BookMove
+	for _, e := range entries {
+		if m, err := DecodeMove(b, e.Move); err == nil {
+			moves = append(moves, BookMove{Move: m, Weight: e.Weight})
+		}
+	}
+	return moves, nil
+}
+
+// Picks a book move at random, with probability proportional to its weight.
+// Returns false if the position is not in the book, or all its moves have zero weight.
+// If r is nil, the default source of math/rand is used.
+func (bk *Book) PickMove(b *dragontoothmg.Board, r *rand.Rand) (dragontoothmg.Move, bool, error) {
+	moves, err := bk.Moves(b)
+	if err != nil {
+		return 0, false, err
+	}
+	total := 0
+	for _, m := range moves {
+		total += int(m.Weight)
+	}
+	if total == 0 {
+		return 0, false, nil
+	}
+	var n int
+	if r != nil {
+		n = r.Intn(total)
+	} else {
+		n = rand.Intn(total)
+	}
+	for _, m := range moves {
+		if n < int(m.Weight) {
+			return m.Move, true, nil
+		}
+		n -= int(m.Weight)
+	}
+	panic("unreachable")
+}
@@ -0,0 +1,140 @@
+// Package polyglot reads opening books in the Polyglot .bin format.
+//
+// A book is a sorted array of 16-byte entries, each holding a position key, a move, a
+// weight and a learning value, all big-endian. Positions are identified by the Polyglot
+// Zobrist key computed by Key, which is independent of Board.Hash.
+package polyglot
+
+import (
+	"errors"
+	"math/bits"
+
+	"github.com/dylhunn/dragontoothmg"
+)
+
+// The Polyglot piece kinds, in the order used to index the random numbers.
+// Black pieces have even indices, and white pieces odd ones.
+var pieceKinds = [...]dragontoothmg.Piece{dragontoothmg.Pawn, dragontoothmg.Knight,
+	dragontoothmg.Bishop, dragontoothmg.Rook, dragontoothmg.Queen, dragontoothmg.King}
+
+// Computes the Polyglot key of a position.
+// As Polyglot requires, the en passant file is only included if a pawn of the side
+// to move stands next to the pawn that just advanced two squares (even if capturing
+// it would be illegal).
+func Key(b *dragontoothmg.Board) uint64 {
+	var key uint64
+	for kind, piece := range pieceKinds {
+		black := *pieceBitboard(&b.Black, piece)
+		white := *pieceBitboard(&b.White, piece)
+		for ; black != 0; black &= black - 1 {
+			key ^= random64[64*(2*kind)+bits.TrailingZeros64(black)]
+		}
+		for ; white != 0; white &= white - 1 {
+			key ^= random64[64*(2*kind+1)+bits.TrailingZeros64(white)]
+		}
+	}
+	castling := []struct{ white, kingside bool }{{true, true}, {true, false}, {false, true}, {false, false}}
+	for i, c := range castling {
+		if b.CanCastle(c.white, c.kingside) {
+			key ^= random64[randomCastle+i]
+		}
+	}
+	if ep := b.Enpassant(); ep != 0 {
+		ourPawns := b.Black.Pawns
+		if b.Wtomove {
+			ourPawns = b.White.Pawns
+		}
+		// Our pawns that attack the en passant square are exactly those next to the pawn.
+		if dragontoothmg.PawnAttacks(dragontoothmg.Square(ep), !b.Wtomove)&ourPawns != 0 {
+			key ^= random64[randomEnPassant+int(ep%8)]
+		}
+	}
+	if b.Wtomove {
+		key ^= random64[randomTurn]
+	}
+	return key
+}
+
+func pieceBitboard(bb *dragontoothmg.Bitboards, piece dragontoothmg.Piece) *uint64 {
+	switch piece {
+	case dragontoothmg.Pawn:
+		return &bb.Pawns
+	case dragontoothmg.Knight:
+		return &bb.Knights
+	case dragontoothmg.Bishop:
+		return &bb.Bishops
+	case dragontoothmg.Rook:
+		return &bb.Rooks
+	case dragontoothmg.Queen:
+		return &bb.Queens
+	default:
+		return &bb.Kings
+	}
+}
+
+// Polyglot promotion pieces, indexed by the promotion field of a book move.
+var promotionPieces = [...]dragontoothmg.Piece{dragontoothmg.Nothing, dragontoothmg.Knight,
+	dragontoothmg.Bishop, dragontoothmg.Rook, dragontoothmg.Queen}
+
+// Decodes a Polyglot book move in the given position. Polyglot encodes castling as the
+// king capturing its own rook ("e1h1"); unless the board is a Chess960 board, this is
+// converted to the usual king move ("e1g1"). Returns an error if the move is illegal,
+// which can happen if the book is corrupt or two positions share a key.
+func DecodeMove(b *dragontoothmg.Board, raw uint16) (dragontoothmg.Move, error) {
+	to := uint8(raw & 0x3f)
+	from := uint8((raw >> 6) & 0x3f)
+	promote := int(raw>>12) & 0x7
+	if promote >= len(promotionPieces) {
+		return 0, errors.New("Invalid Polyglot move: bad promotion piece")
+	}
+	ourPieces := &b.Black
+	if b.Wtomove {
+		ourPieces = &b.White
+	}
+	if !b.Chess960 && bitSet(ourPieces.Kings, from) && bitSet(ourPieces.Rooks, to) {
+		if to > from {
+			to = from + 2
+		} else {
+			to = from - 2
+		}
+	}
+	var m dragontoothmg.Move
+	m.Setfrom(dragontoothmg.Square(from)).Setto(dragontoothmg.Square(to)).Setpromote(promotionPieces[promote])
+	for _, legal := range b.GenerateLegalMoves() {
+		if legal.Base() == m {
+			return legal, nil
+		}
+	}
+	return 0, errors.New("Illegal Polyglot move: " + m.String())
+}
+
+// Encodes a legal move in the given position as a Polyglot book move.
+func EncodeMove(b *dragontoothmg.Board, m dragontoothmg.Move) uint16 {
+	from, to := m.From(), m.To()
+	ourPieces := &b.Black
+	if b.Wtomove {
+		ourPieces = &b.White
+	}
+	if bitSet(ourPieces.Kings, from) && (to == from+2 || to+2 == from) && !bitSet(ourPieces.Rooks, to) {
+		// Standard castling: find the rook the king moves towards.
+		rank := from &^ 7
+		if to > from {
+			for to = rank + 7; to > from && !bitSet(ourPieces.Rooks, to); to-- {
+			}
+		} else {
+			for to = rank; to < from && !bitSet(ourPieces.Rooks, to); to++ {
+			}
+		}
+	}
+	var promote uint16
+	for i, piece := range promotionPieces {
+		if piece == m.Promote() {
+			promote = uint16(i)
+		}
+	}
+	return promote<<12 | uint16(from)<<6 | uint16(to)
+}
+
+func bitSet(bitboard uint64, sq uint8) bool {
+	return bitboard&(uint64(1)<<sq) != 0
+}
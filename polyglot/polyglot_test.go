@@ -0,0 +1,124 @@
+package polyglot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/dylhunn/dragontoothmg"
+)
+
+// Keys from the Polyglot format specification.
+func TestKey(t *testing.T) {
+	keys := []struct {
+		fen string
+		key uint64
+	}{
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", 0x463b96181691fc9c},
+		{"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1", 0x823c9b50fd114196},
+		{"rnbqkbnr/ppp1pppp/8/3p4/4P3/8/PPPP1PPP/RNBQKBNR w KQkq d6 0 2", 0x0756b94461c50fb0},
+		{"rnbqkbnr/ppp1pppp/8/3pP3/8/8/PPPP1PPP/RNBQKBNR b KQkq - 0 2", 0x662fafb965db29d4},
+		{"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3", 0x22a48b5a8e47ff78},
+		{"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPPKPPP/RNBQ1BNR b kq - 0 3", 0x652a607ca3f242c1},
+		{"rnbq1bnr/ppp1pkpp/8/3pPp2/8/8/PPPPKPPP/RNBQ1BNR w - - 0 4", 0x00fdd303c946bdd9},
+		{"rnbqkbnr/p1pppppp/8/8/PpP4P/8/1P1PPPP1/RNBQKBNR b KQkq c3 0 3", 0x3c8123ea7b067637},
+		{"rnbqkbnr/p1pppppp/8/8/P6P/R1p5/1P1PPPP1/1NBQKBNR b Kkq - 0 4", 0x5c3f9b829b279560},
+	}
+	for _, k := range keys {
+		b := dragontoothmg.ParseFen(k.fen)
+		if key := Key(&b); key != k.key {
+			t.Errorf("Wrong key %016x for %v (expected %016x)", key, k.fen, k.key)
+		}
+	}
+}
+
+func TestMoveEncoding(t *testing.T) {
+	moves := []struct {
+		fen  string
+		move string
+		raw  uint16
+	}{
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "e2e4", 0x031c},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1g1", 0x0107},
+		{"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "e8c8", 0x0f38},
+		{"4k3/1P6/8/8/8/8/8/4K3 w - - 0 1", "b7b8n", 0x1c79},
+		{"4k3/1P6/8/8/8/8/8/4K3 w - - 0 1", "b7b8q", 0x4c79},
+		// In Chess960, castling moves are already encoded as the king taking the rook.
+		{"bqnb1rkr/1p3ppp/p2ppn2/2p5/5P2/P2P4/NPP1PRPP/BQ1BN1KR w Hhf - 0 10", "g1h1", 0x0187},
+	}
+	for _, m := range moves {
+		b := dragontoothmg.ParseFen(m.fen)
+		move, err := dragontoothmg.ParseMove(m.move)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if raw := EncodeMove(&b, move); raw != m.raw {
+			t.Errorf("Wrong encoding %04x of %v in %v", raw, m.move, m.fen)
+		}
+		decoded, err := DecodeMove(&b, m.raw)
+		if err != nil || decoded.Base() != move {
+			t.Errorf("Wrong decoding %v of %04x in %v: %v", decoded.String(), m.raw, m.fen, err)
+		}
+	}
+	b := dragontoothmg.ParseFen("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	if _, err := DecodeMove(&b, 0x0107); err == nil {
+		t.Error("Decoded an illegal move")
+	}
+}
+
+// Builds an in-memory book holding the given entries.
+func makeBook(t *testing.T, entries []Entry) *Book {
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	var buf bytes.Buffer
+	for _, e := range entries {
+		binary.Write(&buf, binary.BigEndian, e)
+	}
+	book, err := NewBook(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return book
+}
+
+func TestBook(t *testing.T) {
+	start := dragontoothmg.ParseFen(dragontoothmg.Startpos)
+	startKey := Key(&start)
+	book := makeBook(t, []Entry{
+		{Key: startKey - 1, Move: 0x0001, Weight: 1},
+		{Key: startKey, Move: 0x031c, Weight: 30},  // e2e4
+		{Key: startKey, Move: 0x02db, Weight: 10},  // d2d4
+		{Key: startKey, Move: 0x0107, Weight: 100}, // e1g1, illegal
+		{Key: startKey, Move: 0x0195, Weight: 0},   // g1f3
+		{Key: startKey + 1, Move: 0x0002, Weight: 1},
+	})
+	moves, err := book.Moves(&start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moves) != 3 || moves[0].Move.String() != "e2e4" || moves[1].Move.String() != "d2d4" ||
+		moves[2].Move.String() != "g1f3" || moves[0].Weight != 30 {
+		t.Error("Wrong book moves:", moves)
+	}
+	counts := map[string]int{}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 4000; i++ {
+		m, ok, err := book.PickMove(&start, r)
+		if !ok || err != nil {
+			t.Fatal("No move picked:", err)
+		}
+		counts[m.String()]++
+	}
+	if counts["g1f3"] != 0 || counts["e2e4"] < 2700 || counts["e2e4"] > 3300 || counts["d2d4"] < 700 {
+		t.Error("Moves not picked according to their weights:", counts)
+	}
+
+	b := dragontoothmg.ParseFen("4k3/8/8/8/8/8/8/4K3 w - - 0 1")
+	if _, ok, err := book.PickMove(&b, r); ok || err != nil {
+		t.Error("Picked a move for a position not in the book:", err)
+	}
+	if _, err := NewBook(bytes.NewReader(make([]byte, 20)), 20); err == nil {
+		t.Error("Accepted a truncated book")
+	}
+}
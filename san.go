@@ -0,0 +1,174 @@
+package dragontoothmg
+
+import (
+	"errors"
+	"strings"
+)
+
+// Standard Algebraic Notation (SAN) support for moves.
+// SAN is context-sensitive, so both directions need the board on which the move is played.
+
+var sanPieceLetters = [7]string{"", "", "N", "B", "R", "Q", "K"}
+
+// Converts a move to Standard Algebraic Notation, such as "Nbd7", "exd6", "e8=Q+" or "O-O".
+// The move must be legal in the current position (i.e., in the set of moves found by
+// GenerateLegalMoves()); otherwise, the result is undefined.
+func (b *Board) MoveToSAN(m Move) string {
+	piece := b.PieceAt(m.From())
+	var san string
+	if castle, kingside := b.isCastle(m); castle {
+		if kingside {
+			san = "O-O"
+		} else {
+			san = "O-O-O"
+		}
+	} else if piece == Pawn {
+		if IsCapture(m, b) {
+			san = IndexToAlgebraic(Square(m.From()))[0:1] + "x"
+		}
+		san += IndexToAlgebraic(Square(m.To()))
+		if m.Promote() != Nothing {
+			san += "=" + sanPieceLetters[m.Promote()]
+		}
+	} else {
+		san = sanPieceLetters[piece] + b.sanDisambiguation(m, piece)
+		if IsCapture(m, b) {
+			san += "x"
+		}
+		san += IndexToAlgebraic(Square(m.To()))
+	}
+	return san + b.sanCheckSuffix(m)
+}
+
+// Returns the minimal origin qualifier (file, rank, or full square) needed to tell
+// the move apart from other legal moves of the same piece type to the same square.
+func (b *Board) sanDisambiguation(m Move, piece Piece) string {
+	var ambiguous, sameFile, sameRank bool
+	for _, other := range b.GenerateLegalMoves() {
+		if other.Base() == m.Base() || other.To() != m.To() || b.PieceAt(other.From()) != piece {
+			continue
+		}
+		ambiguous = true
+		if other.From()%8 == m.From()%8 {
+			sameFile = true
+		}
+		if other.From()/8 == m.From()/8 {
+			sameRank = true
+		}
+	}
+	origin := IndexToAlgebraic(Square(m.From()))
+	switch {
+	case !ambiguous:
+		return ""
+	case !sameFile:
+		return origin[0:1]
+	case !sameRank:
+		return origin[1:2]
+	default:
+		return origin
+	}
+}
+
+// Returns "+" if the move gives check, "#" if it gives checkmate, and "" otherwise.
+func (b *Board) sanCheckSuffix(m Move) string {
+	unapply := b.Apply(m)
+	defer unapply()
+	if !b.OurKingInCheck() {
+		return ""
+	}
+	if len(b.GenerateLegalMoves()) == 0 {
+		return "#"
+	}
+	return "+"
+}
+
+// Parses a move in Standard Algebraic Notation, in the context of the current position.
+// Check and annotation suffixes ("+", "#", "!", "?") are accepted and ignored, as are
+// castling moves written with zeros ("0-0"). The move must be legal in the current position.
+// Some example valid move strings:
+// e4 exd5 Nbd7 R1e2 Qh4xe1 e8=Q O-O-O Kxf7#
+func (b *Board) ParseSAN(san string) (Move, error) {
+	trimmed := strings.TrimRight(san, "+#!?")
+	if len(trimmed) < 2 {
+		return 0, errors.New("Invalid SAN move: " + san)
+	}
+	legalMoves := b.GenerateLegalMoves()
+
+	// Castling is written from the king's point of view.
+	if castle := strings.Replace(trimmed, "0", "O", -1); castle == "O-O" || castle == "O-O-O" {
+		for _, m := range legalMoves {
+			if isCastle, kingside := b.isCastle(m); isCastle && kingside == (castle == "O-O") {
+				return m, nil
+			}
+		}
+		return 0, errors.New("Illegal SAN move: " + san)
+	}
+
+	// Identify the moving piece type; pawn moves have no piece letter.
+	piece := Piece(Pawn)
+	for p := Piece(Knight); p <= King; p++ {
+		if trimmed[0:1] == sanPieceLetters[p] {
+			piece = p
+			trimmed = trimmed[1:]
+			break
+		}
+	}
+
+	// Strip the promotion suffix, written as "=Q" or just "Q".
+	promote := Piece(Nothing)
+	if piece == Pawn && len(trimmed) > 2 {
+		last := strings.ToUpper(trimmed[len(trimmed)-1:])
+		for p := Piece(Knight); p <= Queen; p++ {
+			if last == sanPieceLetters[p] {
+				promote = p
+				trimmed = strings.TrimSuffix(trimmed[:len(trimmed)-1], "=")
+				break
+			}
+		}
+	}
+
+	// What remains is [origin qualifier][x]destination.
+	if len(trimmed) < 2 {
+		return 0, errors.New("Invalid SAN move: " + san)
+	}
+	to, err := AlgebraicToIndex(trimmed[len(trimmed)-2:])
+	if err != nil {
+		return 0, errors.New("Invalid SAN move: " + san)
+	}
+	qualifier := strings.TrimSuffix(trimmed[:len(trimmed)-2], "x")
+	if len(qualifier) > 2 {
+		return 0, errors.New("Invalid SAN move: " + san)
+	}
+	fromFile, fromRank := -1, -1
+	for _, c := range qualifier {
+		switch {
+		case c >= 'a' && c <= 'h':
+			fromFile = int(c - 'a')
+		case c >= '1' && c <= '8':
+			fromRank = int(c - '1')
+		default:
+			return 0, errors.New("Invalid SAN move: " + san)
+		}
+	}
+
+	var result Move
+	matches := 0
+	for _, m := range legalMoves {
+		if m.To() != to || m.Promote() != promote || b.PieceAt(m.From()) != piece {
+			continue
+		}
+		if (fromFile != -1 && int(m.From()%8) != fromFile) ||
+			(fromRank != -1 && int(m.From()/8) != fromRank) {
+			continue
+		}
+		result = m
+		matches++
+	}
+	switch {
+	case matches == 0:
+		return 0, errors.New("Illegal SAN move: " + san)
+	case matches > 1:
+		return 0, errors.New("Ambiguous SAN move: " + san)
+	}
+	return result, nil
+}
@@ -0,0 +1,96 @@
+package dragontoothmg
+
+import (
+	"testing"
+)
+
+func TestMoveToSAN(t *testing.T) {
+	tests := []struct {
+		fen  string
+		move string
+		san  string
+	}{
+		{Startpos, "e2e4", "e4"},
+		{Startpos, "g1f3", "Nf3"},
+		// captures, with and without pawns
+		{"rnbqkbnr/ppp1pppp/8/3p4/4P3/8/PPPP1PPP/RNBQKBNR w KQkq d6 0 2", "e4d5", "exd5"},
+		{"r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 2 3", "f3e5", "Nxe5"},
+		// en passant
+		{"r3k3/1ppp1ppr/8/3Pp3/8/8/1PP1PPPP/R3K2R w - e6 3 1", "d5e6", "dxe6"},
+		// castling
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", "e1g1", "O-O"},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", "e1c1", "O-O-O"},
+		// disambiguation by file, rank and full square
+		{"7k/8/8/8/8/8/8/R4RK1 w - - 0 1", "a1d1", "Rad1"},
+		{"4k3/8/8/R7/8/8/8/R3K3 w - - 0 1", "a1a3", "R1a3"},
+		{"7k/8/8/8/2Q1Q3/8/4Q3/K7 w - - 0 1", "e4d3", "Qe4d3"},
+		// a pinned piece does not need disambiguating
+		{"7k/8/8/4b3/8/2N3N1/8/K7 w - - 0 1", "g3e4", "Ne4"},
+		// promotions
+		{"r3k3/1pp3P1/4N3/3b4/8/2p5/1P2PP1P/R3K2R w - - 0 1", "g7g8q", "g8=Q+"},
+		{"r3k3/1pp5/4N3/3br3/8/2p3n1/1p2PP2/R1B1K2n b - - 0 1", "b2c1n", "bxc1=N"},
+		// checkmate
+		{"5k2/5p2/5P2/8/8/2r5/2rR2K1/4B2R w - - 0 1", "h1h8", "Rh8#"},
+	}
+	for _, test := range tests {
+		b := parseFenAndValidate(t, test.fen)
+		san := b.MoveToSAN(parseMove(test.move))
+		if san != test.san {
+			t.Error("Wrong SAN for", test.move, "in", test.fen, "\nExpected", test.san, "but got", san)
+		}
+		m, err := b.ParseSAN(test.san)
+		if err != nil || m.Base() != parseMove(test.move) {
+			t.Error("Failed to parse SAN", test.san, "in", test.fen, "got", &m, err)
+		}
+	}
+}
+
+func TestParseSANVariants(t *testing.T) {
+	b := parseFenAndValidate(t, "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	variants := map[string]string{
+		"0-0":    "e1g1",
+		"O-O-O+": "e1c1",
+		"Nxd7":   "e5d7",
+		"Ne5xd7": "e5d7",
+		"dxe6!?": "d5e6",
+		"Qxf6":   "f3f6",
+		"gxh3":   "g2h3",
+	}
+	for san, uci := range variants {
+		m, err := b.ParseSAN(san)
+		if err != nil || m.Base() != parseMove(uci) {
+			t.Error("Failed to parse SAN", san, "got", &m, err)
+		}
+	}
+	invalid := []string{"", "x", "Qxa8", "Ke3", "Nc3xe4", "e9", "Zf3", "e4e5e6"}
+	for _, san := range invalid {
+		if _, err := b.ParseSAN(san); err == nil {
+			t.Error("Expected an error parsing SAN", san)
+		}
+	}
+	// Knights on b6 and e5 can both reach d7
+	b2 := parseFenAndValidate(t, "4k3/8/1N6/4N3/8/8/8/4K3 w - - 0 1")
+	if _, err := b2.ParseSAN("Nd7"); err == nil {
+		t.Error("Expected ambiguous SAN to fail")
+	}
+}
+
+// Every legal move must survive a round trip through SAN.
+func TestSANRoundTrip(t *testing.T) {
+	fens := []string{
+		Startpos,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N b - - 0 1",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+	}
+	for _, fen := range fens {
+		b := parseFenAndValidate(t, fen)
+		for _, m := range b.GenerateLegalMoves() {
+			san := b.MoveToSAN(m)
+			parsed, err := b.ParseSAN(san)
+			if err != nil || parsed != m {
+				t.Error("SAN round trip failed for", &m, "as", san, "in", fen, err)
+			}
+		}
+	}
+}
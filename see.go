@@ -0,0 +1,101 @@
+package dragontoothmg
+
+// Piece values, in centipawns, used by static exchange evaluation.
+var seePieceValues = [...]int{Nothing: 0, Pawn: 100, Knight: 300, Bishop: 300, Rook: 500, Queen: 900, King: 20000}
+
+// Static exchange evaluation: the material gain (in centipawns) for the side to move
+// after playing m and then exchanging on its destination square, with each side always
+// recapturing with its least valuable attacker and free to stop when it is losing.
+// Attackers revealed behind sliders (x-rays) are included, as are promotions and en passant.
+// Pins are ignored, and the king only recaptures if the square is no longer defended.
+// The move must be legal in the current position; quiet moves are evaluated as well
+// (a negative score means the moved piece can be won). Castling moves evaluate to zero.
+func (b *Board) SEE(m Move) int {
+	if castle, _ := b.isCastle(m); castle {
+		return 0
+	}
+	var gain [32]int
+	from, to := m.From(), m.To()
+	toBitboard := uint64(1) << to
+	occupancy := (b.White.All | b.Black.All) &^ (uint64(1) << from)
+
+	attacker := b.pieces[from]
+	gain[0] = seePieceValues[b.pieces[to]]
+	if attacker == Pawn && to == b.enpassant && b.enpassant != 0 {
+		gain[0] = seePieceValues[Pawn]
+		if b.Wtomove {
+			occupancy &^= toBitboard >> 8
+		} else {
+			occupancy &^= toBitboard << 8
+		}
+	}
+	if m.Promote() != Nothing {
+		gain[0] += seePieceValues[m.Promote()] - seePieceValues[Pawn]
+		attacker = m.Promote()
+	}
+	promotionRank := toBitboard&(onlyRank[0]|onlyRank[7]) != 0
+
+	// Alternate recaptures, recording the speculative gain for the capturing side.
+	white := !b.Wtomove
+	depth := 0
+	for depth+1 < len(gain) {
+		attackers := b.AttackersTo(Square(to), occupancy) & occupancy
+		var ourPieces, theirPieces *Bitboards
+		if white {
+			ourPieces, theirPieces = &b.White, &b.Black
+		} else {
+			ourPieces, theirPieces = &b.Black, &b.White
+		}
+		ourAttackers := attackers & ourPieces.All
+		if ourAttackers == 0 {
+			break
+		}
+		var recapturer Piece
+		var recapturerBitboard uint64
+		for piece := Piece(Pawn); piece <= King; piece++ {
+			if candidates := ourAttackers & *ourPieces.pieceBitboard(piece); candidates != 0 {
+				recapturer, recapturerBitboard = piece, candidates&-candidates
+				break
+			}
+		}
+		if recapturer == King && attackers&theirPieces.All != 0 {
+			break // the king cannot recapture onto a defended square
+		}
+		depth++
+		gain[depth] = seePieceValues[attacker] - gain[depth-1]
+		attacker = recapturer
+		if recapturer == Pawn && promotionRank {
+			gain[depth] += seePieceValues[Queen] - seePieceValues[Pawn]
+			attacker = Queen
+		}
+		occupancy &^= recapturerBitboard
+		white = !white
+	}
+	// Either side may decline to continue the exchange.
+	for ; depth > 0; depth-- {
+		if gain[depth] > -gain[depth-1] {
+			gain[depth-1] = -gain[depth]
+		}
+	}
+	return gain[0]
+}
+
+// Whether the static exchange evaluation of m is at least threshold.
+// Useful for pruning captures in quiescence search, e.g. SEEGreaterOrEqual(m, 0).
+func (b *Board) SEEGreaterOrEqual(m Move, threshold int) bool {
+	if castle, _ := b.isCastle(m); castle {
+		return threshold <= 0
+	}
+	// The exchange can only gain the captured piece (plus any promotion).
+	bestCase := seePieceValues[b.pieces[m.To()]]
+	if m.Promote() != Nothing {
+		bestCase += seePieceValues[m.Promote()] - seePieceValues[Pawn]
+	}
+	if m.To() == b.enpassant && b.enpassant != 0 && b.pieces[m.From()] == Pawn {
+		bestCase = seePieceValues[Pawn]
+	}
+	if bestCase < threshold {
+		return false
+	}
+	return b.SEE(m) >= threshold
+}
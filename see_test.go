@@ -0,0 +1,42 @@
+package dragontoothmg
+
+import (
+	"testing"
+)
+
+func TestSEE(t *testing.T) {
+	tests := []struct {
+		fen      string
+		move     string
+		expected int
+	}{
+		// undefended pawn
+		{"1k1r4/1pp4p/p7/4p3/8/P5P1/1PP4P/2K1R3 w - - 0 1", "e1e5", 100},
+		// x-rays through sliders on both sides
+		{"1k1r3q/1ppn3p/p4b2/4p3/8/P2N2P1/1PP1R1BP/2K1Q3 w - - 0 1", "d3e5", -200},
+		{"4k3/8/4p3/3p4/8/8/3R4/3RK3 w - - 0 1", "d2d5", -300},
+		// a quiet move onto an attacked square
+		{"4k3/8/4p3/8/8/8/8/3QK3 w - - 0 1", "d1d5", -900},
+		{"4k3/8/8/8/8/8/8/3QK3 w - - 0 1", "d1d5", 0},
+		// en passant
+		{"4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", "e5d6", 100},
+		{"4k3/2p5/8/3pP3/8/8/8/4K3 w - d6 0 1", "e5d6", 0},
+		// promotions
+		{"4k3/1P6/8/8/8/8/8/4K3 w - - 0 1", "b7b8q", 800},
+		{"1rk5/P7/8/8/8/8/8/4K3 w - - 0 1", "a7b8q", 400},
+		{"1rk5/P7/8/8/8/8/8/4K3 w - - 0 1", "a7b8n", 400},
+		// the king cannot recapture onto a defended square
+		{"3rk3/3r4/8/8/8/8/2Kp4/3R4 w - - 0 1", "d1d2", -400},
+		{"4k3/3r4/8/8/8/8/2Kp4/3R4 w - - 0 1", "d1d2", 100},
+	}
+	for _, test := range tests {
+		b := parseFenAndValidate(t, test.fen)
+		m := parseMove(test.move)
+		if see := b.SEE(m); see != test.expected {
+			t.Error("SEE of", test.move, "in", test.fen, "was", see, "but expected", test.expected)
+		}
+		if !b.SEEGreaterOrEqual(m, test.expected) || b.SEEGreaterOrEqual(m, test.expected+1) {
+			t.Error("SEEGreaterOrEqual disagrees with SEE for", test.move, "in", test.fen)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package syzygy
+
+import (
+	"math/bits"
+	"sort"
+
+	"github.com/dylhunn/dragontoothmg"
+)
+
+// The largest number of pieces in a table supported by the index encoding.
+const maxPieces = 7
+
+// Tables used to turn the squares of a position into an index into a table.
+// They follow the layout chosen by the Syzygy generator, and are computed in init.
+var (
+	mapPawns      [64]int     // squares a2-h7 to 0..47, the lead pawn being the highest
+	mapB1H1H7     [64]int     // squares below the a1-h8 diagonal to 0..27
+	mapA1D1D4     [64]int     // squares in the a1-d1-d4 triangle to 0..9
+	mapKK         [10][64]int // the 462 legal placements of two kings, the first in a1-d1-d4
+	binomial      [6][64]uint64
+	leadPawnIdx   [6][64]uint64
+	leadPawnsSize [6][4]uint64
+)
+
+// The rank minus the file of a square: zero on the a1-h8 diagonal, negative below it.
+func offA1H8(sq int) int {
+	return sq/8 - sq%8
+}
+
+func init() {
+	code := 0
+	for sq := 0; sq < 64; sq++ {
+		if offA1H8(sq) < 0 {
+			mapB1H1H7[sq] = code
+			code++
+		}
+	}
+
+	// Squares on the diagonal are encoded after the others.
+	var diagonal []int
+	code = 0
+	for sq := 0; sq <= 27; sq++ { // a1 to d4
+		if offA1H8(sq) < 0 && sq%8 <= 3 {
+			mapA1D1D4[sq] = code
+			code++
+		} else if offA1H8(sq) == 0 && sq%8 <= 3 {
+			diagonal = append(diagonal, sq)
+		}
+	}
+	for _, sq := range diagonal {
+		mapA1D1D4[sq] = code
+		code++
+	}
+
+	// If the first king is on the diagonal, the second can't be above it. Placements
+	// with both kings on the diagonal are encoded after the others.
+	type kingPair struct{ idx, sq int }
+	var bothOnDiagonal []kingPair
+	code = 0
+	for idx := 0; idx < 10; idx++ {
+		for s1 := 0; s1 <= 27; s1++ {
+			if mapA1D1D4[s1] != idx || (idx == 0 && s1 != 1) { // b1 is mapped to 0
+				continue
+			}
+			for s2 := 0; s2 < 64; s2++ {
+				if (dragontoothmg.KingAttacks(dragontoothmg.Square(s1))|uint64(1)<<uint(s1))&(uint64(1)<<uint(s2)) != 0 {
+					continue // illegal position
+				} else if offA1H8(s1) == 0 && offA1H8(s2) > 0 {
+					continue // first king on the diagonal, second above it
+				} else if offA1H8(s1) == 0 && offA1H8(s2) == 0 {
+					bothOnDiagonal = append(bothOnDiagonal, kingPair{idx, s2})
+				} else {
+					mapKK[idx][s2] = code
+					code++
+				}
+			}
+		}
+	}
+	for _, p := range bothOnDiagonal {
+		mapKK[p.idx][p.sq] = code
+		code++
+	}
+
+	// binomial[k][n] is the number of ways to choose k elements from n.
+	binomial[0][0] = 1
+	for n := 1; n < 64; n++ {
+		for k := 0; k < 6 && k <= n; k++ {
+			if k > 0 {
+				binomial[k][n] += binomial[k-1][n-1]
+			}
+			if k < n {
+				binomial[k][n] += binomial[k][n-1]
+			}
+		}
+	}
+
+	// mapPawns gives the number of squares available to the other pawns when the lead
+	// pawn is on a square: the lead pawn is the one nearest the edge and, among pawns
+	// on the same file, the one with the lowest rank.
+	available := 47
+	for leadPawns := 1; leadPawns <= 5; leadPawns++ {
+		for file := 0; file < 4; file++ {
+			var idx uint64
+			for rank := 1; rank <= 6; rank++ {
+				sq := 8*rank + file
+				if leadPawns == 1 {
+					mapPawns[sq] = available
+					mapPawns[sq^7] = available - 1
+					available -= 2
+				}
+				leadPawnIdx[leadPawns][sq] = idx
+				idx += binomial[leadPawns-1][mapPawns[sq]]
+			}
+			leadPawnsSize[leadPawns][file] = idx
+		}
+	}
+}
+
+// Piece codes used by the tables: 1 to 6 for white pawn to king, and 9 to 14 for black.
+func pieceCode(piece dragontoothmg.Piece, white bool) uint8 {
+	if white {
+		return uint8(piece)
+	}
+	return uint8(piece) | 8
+}
+
+// Computes the index of a position in a table, and returns the part of the table
+// that holds it along with the file of the lead pawn (or 0 without pawns). Returns
+// false if the table only stores positions with the other side to move.
+func (t *table) index(b *dragontoothmg.Board) (*pairsData, int, uint64, bool) {
+	var squares [maxPieces]int
+	var pieces [maxPieces]uint8
+	var idx uint64
+	var leadPawns uint64
+	size, leadPawnsCnt, tbFile := 0, 0, 0
+
+	// Tables are stored with the stronger side as white, and symmetric tables only
+	// store white to move, so the colors and ranks may need to be swapped.
+	blackToMove := !b.Wtomove
+	symmetricBlackToMove := t.key == t.key2 && blackToMove
+	blackStronger := materialKey(b) != t.key
+	flip := symmetricBlackToMove || blackStronger
+	var flipColor uint8
+	flipSquares := 0
+	if flip {
+		flipColor, flipSquares = 8, 56
+	}
+	stm := 0
+	if flip != blackToMove {
+		stm = 1
+	}
+
+	// For tables with pawns, there is a separate part for each file of the lead pawn.
+	if t.hasPawns {
+		pc := t.get(0, 0).pieces[0] ^ flipColor
+		leadPawns = b.White.Pawns
+		if pc&8 != 0 {
+			leadPawns = b.Black.Pawns
+		}
+		for bb := leadPawns; bb != 0; bb &= bb - 1 {
+			squares[size] = bits.TrailingZeros64(bb) ^ flipSquares
+			size++
+		}
+		leadPawnsCnt = size
+		best := 0
+		for i := 1; i < leadPawnsCnt; i++ {
+			if mapPawns[squares[i]] > mapPawns[squares[best]] {
+				best = i
+			}
+		}
+		squares[0], squares[best] = squares[best], squares[0]
+		tbFile = squares[0] % 8
+		if tbFile > 3 {
+			tbFile = 7 - tbFile
+		}
+	}
+
+	// DTZ tables only store one side to move.
+	if t.dtz && !t.dtzStoresSide(stm, tbFile) {
+		return nil, 0, 0, false
+	}
+
+	for bb := (b.White.All | b.Black.All) &^ leadPawns; bb != 0; bb &= bb - 1 {
+		sq := bits.TrailingZeros64(bb)
+		squares[size] = sq ^ flipSquares
+		pieces[size] = pieceCode(b.PieceAt(uint8(sq)), b.White.All&(uint64(1)<<uint(sq)) != 0) ^ flipColor
+		size++
+	}
+	d := t.get(stm, tbFile)
+
+	// Order the pieces as in the table.
+	for i := leadPawnsCnt; i < size-1; i++ {
+		for j := i + 1; j < size; j++ {
+			if d.pieces[i] == pieces[j] {
+				pieces[i], pieces[j] = pieces[j], pieces[i]
+				squares[i], squares[j] = squares[j], squares[i]
+				break
+			}
+		}
+	}
+
+	// Mirror the board so that the lead piece is on files a-d.
+	if squares[0]%8 > 3 {
+		for i := 0; i < size; i++ {
+			squares[i] ^= 7
+		}
+	}
+
+	if t.hasPawns {
+		idx = leadPawnIdx[leadPawnsCnt][squares[0]]
+		others := squares[1:leadPawnsCnt]
+		sort.SliceStable(others, func(i, j int) bool { return mapPawns[others[i]] < mapPawns[others[j]] })
+		for i := 1; i < leadPawnsCnt; i++ {
+			idx += binomial[i][mapPawns[squares[i]]]
+		}
+	} else {
+		// Without pawns, also mirror the lead piece onto ranks 1-4 and below the a1-h8 diagonal.
+		if squares[0]/8 > 3 {
+			for i := 0; i < size; i++ {
+				squares[i] ^= 56
+			}
+		}
+		for i := 0; i < d.groupLen[0]; i++ {
+			if offA1H8(squares[i]) == 0 {
+				continue
+			}
+			if offA1H8(squares[i]) > 0 {
+				for j := i; j < size; j++ {
+					squares[j] = ((squares[j] >> 3) | (squares[j] << 3)) & 63
+				}
+			}
+			break
+		}
+
+		if t.hasUniquePieces {
+			// The first three pieces are encoded together.
+			adjust1, adjust2 := 0, 0
+			if squares[1] > squares[0] {
+				adjust1++
+			}
+			if squares[2] > squares[0] {
+				adjust2++
+			}
+			if squares[2] > squares[1] {
+				adjust2++
+			}
+			if offA1H8(squares[0]) != 0 {
+				idx = uint64((mapA1D1D4[squares[0]]*63+(squares[1]-adjust1))*62 + squares[2] - adjust2)
+			} else if offA1H8(squares[1]) != 0 {
+				idx = uint64((6*63+(squares[0]/8)*28+mapB1H1H7[squares[1]])*62 + squares[2] - adjust2)
+			} else if offA1H8(squares[2]) != 0 {
+				idx = uint64(6*63*62 + 4*28*62 + (squares[0]/8)*7*28 + (squares[1]/8-adjust1)*28 + mapB1H1H7[squares[2]])
+			} else {
+				idx = uint64(6*63*62 + 4*28*62 + 4*7*28 + (squares[0]/8)*7*6 + (squares[1]/8-adjust1)*6 + (squares[2]/8 - adjust2))
+			}
+		} else {
+			idx = uint64(mapKK[mapA1D1D4[squares[0]]][squares[1]])
+		}
+	}
+
+	// Encode the remaining groups of pawns and pieces, each in ascending order of square.
+	idx *= d.groupIdx[0]
+	groupStart := d.groupLen[0]
+	remainingPawns := t.hasPawns && t.pawnCount[1] > 0
+	for next := 1; d.groupLen[next] != 0; next++ {
+		group := squares[groupStart : groupStart+d.groupLen[next]]
+		sort.Ints(group)
+		var n uint64
+		for i, sq := range group {
+			adjust := 0
+			for _, prev := range squares[:groupStart] {
+				if sq > prev {
+					adjust++
+				}
+			}
+			pawnAdjust := 0
+			if remainingPawns {
+				pawnAdjust = 8
+			}
+			n += binomial[i+1][sq-adjust-pawnAdjust]
+		}
+		remainingPawns = false
+		idx += n * d.groupIdx[next]
+		groupStart += d.groupLen[next]
+	}
+	return d, tbFile, idx, true
+}
@@ -0,0 +1,501 @@
+// Package syzygy probes Syzygy endgame tablebases stored in local .rtbw (WDL) and
+// .rtbz (DTZ) files.
+//
+// WDL tables give the result of a position with perfect play, taking the 50-move rule
+// into account; DTZ tables give the distance to the next capture or pawn move (which
+// resets the 50-move counter) on the way to that result. Positions with castling
+// rights are not in the tables.
+//
+// This is a port of the probing code of Stockfish, itself derived from the original
+// code by Ronald de Man.
+//
+// The tests only probe tables written by their own encoder until the KQvK and KRvK
+// tables from the official generator are added to testdata (see testdata/README.md).
+// Until then, indexing, decompression and DTZ mapping are unverified against real tables.
+package syzygy
+
+import (
+	"errors"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dylhunn/dragontoothmg"
+)
+
+// The result of a position with perfect play, from the point of view of the side to move.
+type WDL int
+
+const (
+	Loss        WDL = -2
+	BlessedLoss WDL = -1 // a loss, but a draw under the 50-move rule
+	Draw        WDL = 0
+	CursedWin   WDL = 1 // a win, but a draw under the 50-move rule
+	Win         WDL = 2
+)
+
+func (w WDL) String() string {
+	switch w {
+	case Loss:
+		return "loss"
+	case BlessedLoss:
+		return "blessed loss"
+	case Draw:
+		return "draw"
+	case CursedWin:
+		return "cursed win"
+	case Win:
+		return "win"
+	}
+	return "invalid"
+}
+
+// Returned when a position can't be probed: it has castling rights, too many pieces,
+// or the table for its material is missing.
+var ErrNotFound = errors.New("Position not in the tablebases")
+
+// A set of Syzygy tables. Tables are opened when they are first probed.
+// A Tablebase is safe for concurrent use.
+type Tablebase struct {
+	dirs      []string
+	maxPieces int
+
+	mu     sync.Mutex
+	tables map[string]*table // by file name; nil if the file is missing or invalid
+}
+
+// Opens the tables in the given directories. Returns an error if none of them
+// contains a WDL table.
+func Open(dirs ...string) (*Tablebase, error) {
+	tb := &Tablebase{dirs: dirs, tables: map[string]*table{}}
+	for _, dir := range dirs {
+		names, err := filepath.Glob(filepath.Join(dir, "*.rtbw"))
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			if n := len(strings.TrimSuffix(filepath.Base(name), ".rtbw")) - 1; n > tb.maxPieces {
+				tb.maxPieces = n // all but the "v"
+			}
+		}
+	}
+	if tb.maxPieces == 0 {
+		return nil, errors.New("No Syzygy tables found in " + strings.Join(dirs, ", "))
+	}
+	return tb, nil
+}
+
+// The number of pieces (including kings) in the largest tables.
+func (tb *Tablebase) MaxPieces() int {
+	return tb.maxPieces
+}
+
+// Closes all the table files.
+func (tb *Tablebase) Close() error {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	var err error
+	for name, t := range tb.tables {
+		if t != nil {
+			if closeErr := t.closer.Close(); closeErr != nil {
+				err = closeErr
+			}
+		}
+		delete(tb.tables, name)
+	}
+	return err
+}
+
+// Probes the WDL tables. The result does not depend on the halfmove clock: a win is
+// reported as a CursedWin only if it can't be won within 50 moves of a capture or pawn
+// move even with the clock at zero.
+func (tb *Tablebase) ProbeWDL(b *dragontoothmg.Board) (WDL, error) {
+	if err := tb.probeable(b); err != nil {
+		return Draw, err
+	}
+	wdl, _, err := tb.search(b, false)
+	return wdl, err
+}
+
+// Probes the DTZ tables, returning the number of plies to the next capture or pawn
+// move, with the sign of the WDL result: positive if the side to move wins, negative if
+// it loses, and zero for draws. The distance is exact for wins and losses that are not
+// affected by the 50-move rule; otherwise it may be one ply too long. Cursed wins and
+// blessed losses have 100 added to the distance.
+func (tb *Tablebase) ProbeDTZ(b *dragontoothmg.Board) (int, error) {
+	if err := tb.probeable(b); err != nil {
+		return 0, err
+	}
+	return tb.probeDTZ(b)
+}
+
+func (tb *Tablebase) probeable(b *dragontoothmg.Board) error {
+	if b.CanCastle(true, true) || b.CanCastle(true, false) || b.CanCastle(false, true) || b.CanCastle(false, false) {
+		return ErrNotFound
+	}
+	if bits.OnesCount64(b.White.All|b.Black.All) > tb.maxPieces {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// The result of a move at the root, with the distance to zeroing counted from the root.
+type RootMove struct {
+	Move dragontoothmg.Move
+	WDL  WDL // the result after the move, taking the halfmove clock into account
+	DTZ  int
+}
+
+// Larger than any DTZ value, so that ranks of root moves keep the order of their results.
+const maxDTZ = 1 << 18
+
+// Probes the DTZ tables for every legal move, and returns the moves that keep the best
+// result the position allows under the 50-move rule, given its halfmove clock (which
+// may turn a win into a draw). Among winning moves, only those that reset the 50-move
+// counter soonest are returned; losing moves are ordered by how long they resist.
+// Repetitions are not taken into account.
+func (tb *Tablebase) ProbeRoot(b *dragontoothmg.Board) ([]RootMove, error) {
+	if err := tb.probeable(b); err != nil {
+		return nil, err
+	}
+	cnt50 := int(b.Halfmoveclock)
+	var moves []RootMove
+	bestRank := -1 << 30
+	for _, m := range b.GenerateLegalMoves() {
+		zeroing := isZeroing(b, m)
+		unapply := b.Apply(m)
+		var dtz int
+		var err error
+		if zeroing {
+			var wdl WDL
+			wdl, err = tb.ProbeWDL(b)
+			dtz = dtzBeforeZeroing(-wdl)
+		} else {
+			dtz, err = tb.probeDTZ(b)
+			dtz = -dtz
+			if dtz > 0 {
+				dtz++
+			} else if dtz < 0 {
+				dtz--
+			}
+		}
+		// A mating move has a distance of one.
+		if err == nil && dtz == 2 && b.OurKingInCheck() && len(b.GenerateLegalMoves()) == 0 {
+			dtz = 1
+		}
+		unapply()
+		if err != nil {
+			return nil, err
+		}
+
+		// Wins that can be completed before the 50-move rule applies rank equally,
+		// and otherwise better moves are ranked higher.
+		var rank int
+		var wdl WDL
+		switch {
+		case dtz > 0 && dtz+cnt50 <= 99:
+			rank, wdl = maxDTZ, Win
+		case dtz > 0:
+			rank, wdl = maxDTZ-(dtz+cnt50), CursedWin
+		case dtz < 0 && -dtz*2+cnt50 < 100:
+			rank, wdl = -maxDTZ, Loss
+		case dtz < 0:
+			rank, wdl = -maxDTZ+(-dtz+cnt50), BlessedLoss
+		}
+		if rank > bestRank {
+			moves, bestRank = moves[:0], rank
+		}
+		if rank == bestRank {
+			moves = append(moves, RootMove{Move: m, WDL: wdl, DTZ: dtz})
+		}
+	}
+
+	// Quicker wins and longer losses first.
+	sort.SliceStable(moves, func(i, j int) bool { return moves[i].DTZ < moves[j].DTZ })
+	if len(moves) > 0 && moves[0].WDL == Win {
+		for i := range moves {
+			if moves[i].DTZ != moves[0].DTZ {
+				moves = moves[:i]
+				break
+			}
+		}
+	}
+	return moves, nil
+}
+
+func isZeroing(b *dragontoothmg.Board, m dragontoothmg.Move) bool {
+	return b.PieceAt(m.From()) == dragontoothmg.Pawn || dragontoothmg.IsCapture(m, b)
+}
+
+// The DTZ of the move before a zeroing move with the given result.
+func dtzBeforeZeroing(wdl WDL) int {
+	switch wdl {
+	case Win:
+		return 1
+	case CursedWin:
+		return 101
+	case BlessedLoss:
+		return -101
+	case Loss:
+		return -1
+	}
+	return 0
+}
+
+func sign(n int) int {
+	if n > 0 {
+		return 1
+	} else if n < 0 {
+		return -1
+	}
+	return 0
+}
+
+// Probes a table for the material of the board. For DTZ tables, wdl is the result of
+// the position, and the returned bool is false if the table only stores the other
+// side to move.
+func (tb *Tablebase) probeTable(b *dragontoothmg.Board, dtz bool, wdl WDL) (int, bool, error) {
+	if b.White.All|b.Black.All == b.White.Kings|b.Black.Kings {
+		return int(Draw), true, nil
+	}
+	t, err := tb.table(b, dtz)
+	if err != nil {
+		return 0, false, err
+	}
+	d, file, idx, ok := t.index(b)
+	if !ok {
+		return 0, false, nil
+	}
+	value, err := t.decompress(d, idx)
+	if err != nil {
+		return 0, false, err
+	}
+	if !dtz {
+		return value - 2, true, nil
+	}
+	return t.mapScore(file, value, wdl), true, nil
+}
+
+// Converts a stored DTZ value into plies.
+func (t *table) mapScore(file int, value int, wdl WDL) int {
+	d := t.get(0, file)
+	if d.flags&flagMapped != 0 {
+		// Indices of the maps for Win, Loss, CursedWin and BlessedLoss.
+		idx := int(d.mapIdx[[...]int{1, 3, 0, 2, 0}[wdl+2]])
+		if d.flags&flagWide != 0 {
+			i := 2 * (idx + value)
+			value = int(t.dtzMap[i]) | int(t.dtzMap[i+1])<<8
+		} else {
+			value = int(t.dtzMap[idx+value])
+		}
+	}
+	if (wdl == Win && d.flags&flagWinPlies == 0) || (wdl == Loss && d.flags&flagLossPlies == 0) ||
+		wdl == CursedWin || wdl == BlessedLoss {
+		value *= 2
+	}
+	return value + 1
+}
+
+// Returns the table for the material of the board, opening it if needed.
+func (tb *Tablebase) table(b *dragontoothmg.Board, dtz bool) (*table, error) {
+	name := tableName(b)
+	if dtz {
+		name += ".rtbz"
+	} else {
+		name += ".rtbw"
+	}
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	t, seen := tb.tables[name]
+	if !seen {
+		t = tb.openTable(name, b, dtz)
+		tb.tables[name] = t
+	}
+	if t == nil {
+		return nil, ErrNotFound
+	}
+	return t, nil
+}
+
+func (tb *Tablebase) openTable(name string, b *dragontoothmg.Board, dtz bool) *table {
+	for _, dir := range tb.dirs {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		info, err := f.Stat()
+		t := newTable(b, dtz)
+		if err == nil {
+			err = t.read(f, info.Size())
+		}
+		if err != nil {
+			f.Close()
+			return nil
+		}
+		t.closer = f
+		return t
+	}
+	return nil
+}
+
+// The probing search. Tables may store any value for positions where the side to
+// move has a winning capture, since the generator treats them as "don't care", and
+// may store a loss when a capture draws. So captures (and, for DTZ probes, pawn moves)
+// have to be searched, and the best of their results and the stored one is the true
+// result. The returned bool is true if a zeroing move is the best move.
+func (tb *Tablebase) search(b *dragontoothmg.Board, checkZeroingMoves bool) (WDL, bool, error) {
+	bestValue := Loss
+	moves := b.GenerateLegalMoves()
+	moveCount := 0
+	for _, m := range moves {
+		if !dragontoothmg.IsCapture(m, b) && (!checkZeroingMoves || b.PieceAt(m.From()) != dragontoothmg.Pawn) {
+			continue
+		}
+		moveCount++
+		unapply := b.Apply(m)
+		value, _, err := tb.search(b, false)
+		unapply()
+		if err != nil {
+			return Draw, false, err
+		}
+		value = -value
+		if value > bestValue {
+			bestValue = value
+			if value >= Win {
+				return value, true, nil // a winning zeroing move
+			}
+		}
+	}
+
+	// If all the moves have been searched, the table isn't needed, and might be wrong:
+	// it does not know about en passant, for instance.
+	noMoreMoves := moveCount > 0 && moveCount == len(moves)
+	var value WDL
+	if noMoreMoves {
+		value = bestValue
+	} else {
+		stored, _, err := tb.probeTable(b, false, Draw)
+		if err != nil {
+			return Draw, false, err
+		}
+		value = WDL(stored)
+	}
+	// The table stores a "don't care" value if the best zeroing move wins.
+	if bestValue >= value {
+		return bestValue, bestValue > Draw || noMoreMoves, nil
+	}
+	return value, false, nil
+}
+
+func (tb *Tablebase) probeDTZ(b *dragontoothmg.Board) (int, error) {
+	wdl, zeroingIsBest, err := tb.search(b, true)
+	if err != nil || wdl == Draw { // DTZ tables don't store draws
+		return 0, err
+	}
+	// The table stores a "don't care" value, or a wrong one if the best move is a
+	// losing en passant capture.
+	if zeroingIsBest {
+		return dtzBeforeZeroing(wdl), nil
+	}
+	dtz, stored, err := tb.probeTable(b, true, wdl)
+	if err != nil {
+		return 0, err
+	}
+	if stored {
+		if wdl == BlessedLoss || wdl == CursedWin {
+			dtz += 100
+		}
+		return dtz * sign(int(wdl)), nil
+	}
+
+	// The table stores the other side to move, so find the best move with a 1-ply search.
+	minDTZ := 0xffff
+	for _, m := range b.GenerateLegalMoves() {
+		zeroing := isZeroing(b, m)
+		unapply := b.Apply(m)
+		if zeroing {
+			// Zeroing moves have the DTZ of the position before them.
+			var value WDL
+			value, _, err = tb.search(b, false)
+			dtz = -dtzBeforeZeroing(value)
+		} else {
+			dtz, err = tb.probeDTZ(b)
+			dtz = -dtz
+		}
+		// A mating move has a distance of one.
+		if err == nil && dtz == 1 && b.OurKingInCheck() && len(b.GenerateLegalMoves()) == 0 {
+			minDTZ = 1
+		}
+		unapply()
+		if err != nil {
+			return 0, err
+		}
+		if !zeroing {
+			dtz += sign(dtz)
+		}
+		// Skip draws, and only pick winning moves when winning.
+		if dtz < minDTZ && sign(dtz) == sign(int(wdl)) {
+			minDTZ = dtz
+		}
+	}
+	if minDTZ == 0xffff { // no legal moves: the position is mate
+		return -1, nil
+	}
+	return minDTZ, nil
+}
+
+// A key for the material on the board: the number of each type of piece, four bits
+// each, with white in the low half and black in the high half.
+func materialKey(b *dragontoothmg.Board) uint64 {
+	return sideMaterial(&b.White) | sideMaterial(&b.Black)<<32
+}
+
+func sideMaterial(bb *dragontoothmg.Bitboards) uint64 {
+	var key uint64
+	for i, pieces := range []uint64{bb.Pawns, bb.Knights, bb.Bishops, bb.Rooks, bb.Queens, bb.Kings} {
+		key |= uint64(bits.OnesCount64(pieces)) << uint(4*i)
+	}
+	return key
+}
+
+func swapColors(key uint64) uint64 {
+	return key>>32 | key<<32
+}
+
+// Whether white comes first in the name of the table: the side with more pieces, or
+// with the more valuable pieces when the numbers are equal.
+func whiteIsStronger(b *dragontoothmg.Board) bool {
+	white, black := bits.OnesCount64(b.White.All), bits.OnesCount64(b.Black.All)
+	if white != black {
+		return white > black
+	}
+	// Compare from queens down to pawns.
+	w, bl := sideMaterial(&b.White), sideMaterial(&b.Black)
+	for shift := 16; shift >= 0; shift -= 4 {
+		if wc, bc := (w>>uint(shift))&0xf, (bl>>uint(shift))&0xf; wc != bc {
+			return wc > bc
+		}
+	}
+	return true
+}
+
+// The name of the table file for the material on the board, without the extension,
+// such as "KRPvKR".
+func tableName(b *dragontoothmg.Board) string {
+	white, black := sideName(&b.White), sideName(&b.Black)
+	if !whiteIsStronger(b) {
+		white, black = black, white
+	}
+	return white + "v" + black
+}
+
+func sideName(bb *dragontoothmg.Bitboards) string {
+	name := "K"
+	for i, pieces := range []uint64{bb.Queens, bb.Rooks, bb.Bishops, bb.Knights, bb.Pawns} {
+		name += strings.Repeat(string("QRBNP"[i]), bits.OnesCount64(pieces))
+	}
+	return name
+}
@@ -0,0 +1,630 @@
+package syzygy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dylhunn/dragontoothmg"
+)
+
+// Builds a table file in which every position with a given side to move has the same
+// value. The pieces are encoded in the given order, with the lead group first. A DTZ
+// table with flagMapped|flagWide gets the given maps for Win, Loss, CursedWin and
+// BlessedLoss.
+func singleValueTable(t *table, pieces []uint8, flags uint8, values [2]uint8, maps [4][]uint16) []byte {
+	var buf bytes.Buffer
+	magic := wdlMagic
+	if t.dtz {
+		magic = dtzMagic
+	}
+	buf.Write(magic[:])
+	var header uint8
+	if t.key != t.key2 {
+		header |= 1
+	}
+	if t.hasPawns {
+		header |= 2
+	}
+	buf.WriteByte(header)
+	files, sides := 1, 2
+	if t.hasPawns {
+		files = 4
+	}
+	if t.dtz || t.key == t.key2 {
+		sides = 1
+	}
+	for f := 0; f < files; f++ {
+		buf.WriteByte(0)
+		if t.hasPawns && t.pawnCount[1] > 0 {
+			buf.WriteByte(0x11) // remaining pawns second
+		}
+		for _, p := range pieces {
+			buf.WriteByte(p | p<<4)
+		}
+	}
+	if buf.Len()%2 == 1 {
+		buf.WriteByte(0)
+	}
+	for f := 0; f < files; f++ {
+		for i := 0; i < sides; i++ {
+			buf.WriteByte(flagSingleValue | flags)
+			buf.WriteByte(values[i])
+		}
+	}
+	if flags&flagMapped != 0 {
+		for _, m := range maps {
+			binary.Write(&buf, binary.LittleEndian, uint16(len(m)))
+			binary.Write(&buf, binary.LittleEndian, m)
+		}
+	}
+	for buf.Len()%64 != 16 {
+		buf.WriteByte(0)
+	}
+	return buf.Bytes()
+}
+
+// Sets up a table for the material of the FEN, with the pieces in the given order.
+func testTable(t *testing.T, fen string, dtz bool, pieces []uint8) *table {
+	b := dragontoothmg.ParseFen(fen)
+	tbl := newTable(&b, dtz)
+	data := singleValueTable(tbl, pieces, 0, [2]uint8{}, [4][]uint16{})
+	if err := tbl.read(bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+	return tbl
+}
+
+// Places pieces on an empty board, with white to move. Squares are indexed from a1 = 0.
+func placePieces(squares []uint8, pieces []byte) dragontoothmg.Board {
+	var board [64]byte
+	for i, sq := range squares {
+		board[sq] = pieces[i]
+	}
+	fen := make([]byte, 0, 80)
+	for rank := 7; rank >= 0; rank-- {
+		empty := byte(0)
+		for file := 0; file < 8; file++ {
+			if c := board[8*rank+file]; c != 0 {
+				if empty > 0 {
+					fen = append(fen, '0'+empty)
+					empty = 0
+				}
+				fen = append(fen, c)
+			} else {
+				empty++
+			}
+		}
+		if empty > 0 {
+			fen = append(fen, '0'+empty)
+		}
+		if rank > 0 {
+			fen = append(fen, '/')
+		}
+	}
+	return dragontoothmg.ParseFen(string(fen) + " w - - 0 1")
+}
+
+// The images of a square under the symmetries of the board: mirroring the files,
+// the ranks, and (without pawns) the a1-h8 diagonal.
+func symmetries(sq uint8, pawns bool) []uint8 {
+	images := []uint8{sq, sq ^ 7}
+	if !pawns {
+		images = append(images, sq^56, sq^63)
+		for _, s := range images[:4] {
+			images = append(images, (s>>3)|(s<<3)&63)
+		}
+	}
+	return images
+}
+
+func TestIndexTables(t *testing.T) {
+	used := map[int]bool{}
+	for idx := 0; idx < 10; idx++ {
+		for sq := 0; sq < 64; sq++ {
+			used[mapKK[idx][sq]] = true
+		}
+	}
+	if len(used) != 462 {
+		t.Error("Expected 462 king placements, got", len(used))
+	}
+	if binomial[2][5] != 10 || binomial[5][63] != 7028847 || binomial[3][2] != 0 {
+		t.Error("Wrong binomial coefficients")
+	}
+	a2, h2, a7, b2 := 8, 15, 48, 9
+	if mapPawns[a2] != 47 || mapPawns[h2] != 46 || mapPawns[a7] != 37 || mapPawns[b2] != 35 {
+		t.Error("Wrong pawn mapping")
+	}
+	for file := 0; file < 4; file++ {
+		if leadPawnsSize[1][file] != 6 {
+			t.Error("Wrong number of single lead pawn placements on file", file)
+		}
+	}
+}
+
+// Every position must have an index in range, and positions that are not mirror images
+// of each other must have different indices. If exact, mirror images must also share
+// their index.
+func checkIndexing(t *testing.T, tbl *table, pieces []byte, pawns bool, exact bool, legal func([]uint8) bool) {
+	classes := map[uint64][64]byte{} // canonical placement by index
+	squares := make([]uint8, len(pieces))
+	var place func(int)
+	place = func(n int) {
+		if n < len(pieces) {
+			for sq := uint8(0); sq < 64; sq++ {
+				if pieces[n] == 'P' && (sq < 8 || sq >= 56) {
+					continue
+				}
+				free := true
+				for _, other := range squares[:n] {
+					free = free && other != sq
+				}
+				if free {
+					squares[n] = sq
+					place(n + 1)
+				}
+			}
+			return
+		}
+		if !legal(squares) {
+			return
+		}
+		b := placePieces(squares, pieces)
+		d, file, idx, ok := tbl.index(&b)
+		if !ok {
+			t.Fatal("No part of the table for", b.ToFen())
+		}
+		groups := 0
+		for d.groupLen[groups] != 0 {
+			groups++
+		}
+		if idx >= d.groupIdx[groups] {
+			t.Fatal("Index out of range for", b.ToFen())
+		}
+		// The canonical placement is the smallest image of the placement.
+		var canonical, image [64]byte
+		for i := range symmetries(0, pawns) {
+			image = [64]byte{}
+			for j, sq := range squares {
+				image[symmetries(sq, pawns)[i]] = pieces[j]
+			}
+			if i == 0 || bytes.Compare(image[:], canonical[:]) < 0 {
+				canonical = image
+			}
+		}
+		key := idx*4 + uint64(file)
+		if c, ok := classes[key]; ok && c != canonical {
+			t.Fatal("Two different positions share an index:", b.ToFen())
+		}
+		classes[key] = canonical
+	}
+	place(0)
+	seen := map[[64]byte]bool{}
+	for _, c := range classes {
+		if seen[c] && exact {
+			t.Fatal("Mirror images have different indices")
+		}
+		seen[c] = true
+	}
+}
+
+func kingsApart(squares []uint8, wk, bk int) bool {
+	return dragontoothmg.KingAttacks(dragontoothmg.Square(squares[wk]))&(uint64(1)<<squares[bk]) == 0
+}
+
+func TestIndexing(t *testing.T) {
+	// Three unique pieces, encoded together.
+	kqk := testTable(t, "8/8/8/8/8/8/8/KQk5 w - - 0 1", false, []uint8{6, 5, 14})
+	checkIndexing(t, kqk, []byte("KQk"), false, true, func(s []uint8) bool {
+		return kingsApart(s, 0, 2) && s[0] < 16 // keep the test quick
+	})
+	// Only the kings are unique. When both are on the a1-h8 diagonal, the knights are
+	// not mirrored onto one side of it, so their mirror images are stored twice.
+	knnk := testTable(t, "8/8/8/8/8/8/8/KNNk4 w - - 0 1", false, []uint8{6, 14, 2, 2})
+	checkIndexing(t, knnk, []byte("KkNN"), false, false, func(s []uint8) bool {
+		return kingsApart(s, 0, 1) && s[2] < s[3] && s[3] < 8
+	})
+	// Pawns, mirrored only along the files.
+	kpk := testTable(t, "8/8/8/8/8/8/P7/K1k5 w - - 0 1", false, []uint8{1, 6, 14})
+	checkIndexing(t, kpk, []byte("PKk"), true, true, func(s []uint8) bool {
+		return kingsApart(s, 1, 2) && s[2] < 32
+	})
+}
+
+// Swapping the colors of all the pieces, mirroring the ranks, and swapping the side to
+// move gives the same entry of the table.
+func TestColorFlip(t *testing.T) {
+	kpk := testTable(t, "8/8/8/8/8/8/P7/K1k5 w - - 0 1", false, []uint8{1, 6, 14})
+	white := dragontoothmg.ParseFen("8/8/2k5/8/8/3P4/8/5K2 w - - 0 1")
+	black := dragontoothmg.ParseFen("5k2/8/3p4/8/8/2K5/8/8 b - - 0 1")
+	d1, f1, idx1, _ := kpk.index(&white)
+	d2, f2, idx2, _ := kpk.index(&black)
+	if d1 != d2 || f1 != f2 || idx1 != idx2 {
+		t.Error("Color flipped positions have different indices:", idx1, idx2)
+	}
+	black.Wtomove = true
+	if d3, _, _, _ := kpk.index(&black); d3 == d1 {
+		t.Error("Both sides to move share a table")
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	// A Huffman code with symbols 0 ("000") and 1 ("001") of length 3, 2 ("01") of
+	// length 2, and 3 ("1") of length 1. Symbols 0, 1 and 2 are the values 0, 4 and 2,
+	// and symbol 3 is the pair of symbols 1 and 2.
+	leaf := func(value int) []byte { return []byte{byte(value), byte(value>>8) | 0xf0, 0xff} }
+	pair := func(l, r int) []byte { return []byte{byte(l), byte(l>>8) | byte(r&0xf)<<4, byte(r >> 4)} }
+	var buf bytes.Buffer
+	buf.Write([]byte{0, 3, 2, 1}) // flags, 8-byte blocks, span of 4, padding
+	binary.Write(&buf, binary.LittleEndian, uint32(2))
+	buf.Write([]byte{3, 1}) // symbol lengths
+	binary.Write(&buf, binary.LittleEndian, []uint16{3, 2, 0, 4})
+	buf.Write(leaf(0))
+	buf.Write(leaf(4))
+	buf.Write(leaf(2))
+	buf.Write(pair(1, 2))
+	sparse := int64(buf.Len())
+	// Values 2, 6 and 10 are at offsets 2, 1 and 5 (past the end) of blocks 0, 1 and 1.
+	buf.Write([]byte{0, 0, 0, 0, 2, 0, 1, 0, 0, 0, 1, 0, 1, 0, 0, 0, 5, 0})
+	lengths := int64(buf.Len())
+	binary.Write(&buf, binary.LittleEndian, []uint16{4, 3, 0})
+	data := int64(buf.Len())
+	buf.Write([]byte{0x84, 0x80, 0, 0, 0, 0, 0, 0}) // 3 0 2 1: 1 000 01 001
+	buf.Write([]byte{0x58, 0, 0, 0, 0, 0, 0, 0})    // 2 2 3: 01 01 1
+
+	tbl := &table{r: bytes.NewReader(buf.Bytes())}
+	d := &pairsData{groupLen: [maxPieces + 1]int{1}, groupIdx: [maxPieces + 1]uint64{1, 9}}
+	c := &cursor{r: tbl.r}
+	d.readSizes(c)
+	if c.err != nil || c.off != sparse {
+		t.Fatal("Failed to read the sizes:", c.err, c.off)
+	}
+	d.sparseIndexOffset, d.blockLengthOffset, d.dataOffset = sparse, lengths, data
+	expected := []int{4, 2, 0, 2, 4, 2, 2, 4, 2}
+	for idx, value := range expected {
+		if v, err := tbl.decompress(d, uint64(idx)); v != value || err != nil {
+			t.Error("Wrong value", v, "at index", idx, err)
+		}
+	}
+}
+
+func writeTables(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "syzygy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := dragontoothmg.ParseFen("8/8/8/8/8/8/8/KQk5 w - - 0 1")
+	pieces := []uint8{6, 5, 14}
+	// White to move wins, and black to move loses, in 5 moves.
+	wdl := singleValueTable(newTable(&b, false), pieces, 0, [2]uint8{4, 0}, [4][]uint16{})
+	dtz := singleValueTable(newTable(&b, true), pieces, 0, [2]uint8{5}, [4][]uint16{})
+	if ioutil.WriteFile(filepath.Join(dir, "KQvK.rtbw"), wdl, 0644) != nil ||
+		ioutil.WriteFile(filepath.Join(dir, "KQvK.rtbz"), dtz, 0644) != nil {
+		t.Fatal("Failed to write the tables")
+	}
+	return dir
+}
+
+func TestProbe(t *testing.T) {
+	dir := writeTables(t)
+	defer os.RemoveAll(dir)
+	tb, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tb.Close()
+	if tb.MaxPieces() != 3 {
+		t.Error("Wrong maximum number of pieces:", tb.MaxPieces())
+	}
+
+	probes := []struct {
+		fen     string
+		wdl     WDL
+		dtz     int
+		missing bool
+	}{
+		{"8/8/4k3/8/8/8/8/K6Q w - - 0 1", Win, 11, false},
+		{"8/8/4k3/8/8/8/8/K6Q b - - 0 1", Loss, -12, false},
+		{"8/8/4K3/8/8/8/8/k6q b - - 0 1", Win, 11, false}, // black is the stronger side
+		{"8/8/4K3/8/8/8/8/k6q w - - 0 1", Loss, -12, false},
+		{"8/8/8/8/8/8/1q6/K5k1 w - - 0 1", Draw, 0, false},  // white takes the queen
+		{"8/8/8/8/8/1k6/2Q5/K7 b - - 0 1", Draw, 0, false},  // black takes the queen
+		{"k7/2Q5/1K6/8/8/8/8/8 b - - 0 1", Loss, -1, false}, // stalemate, unknown to the fake table
+		{"8/8/8/8/8/8/8/K1k5 w - - 0 1", Draw, 0, false},    // no table needed
+		{"8/8/8/8/8/8/P7/K1k5 w - - 0 1", Draw, 0, true},    // missing table
+		{"8/8/8/8/8/8/8/R3K1k1 w Q - 0 1", Draw, 0, true},   // castling rights
+		{"8/8/8/8/8/8/8/KQQ1k3 w - - 0 1", Draw, 0, true},   // too many pieces
+	}
+	for _, p := range probes {
+		b := dragontoothmg.ParseFen(p.fen)
+		wdl, wdlErr := tb.ProbeWDL(&b)
+		dtz, dtzErr := tb.ProbeDTZ(&b)
+		if p.missing {
+			if wdlErr != ErrNotFound || dtzErr != ErrNotFound {
+				t.Error("Expected a missing table for", p.fen, wdlErr, dtzErr)
+			}
+			continue
+		}
+		if wdlErr != nil || dtzErr != nil || wdl != p.wdl || dtz != p.dtz {
+			t.Error("Wrong probe", wdl, dtz, "for", p.fen, wdlErr, dtzErr)
+		}
+		if b.ToFen() != p.fen {
+			t.Error("Board changed by probing:", b.ToFen())
+		}
+	}
+}
+
+func TestProbeRoot(t *testing.T) {
+	dir := writeTables(t)
+	defer os.RemoveAll(dir)
+	tb, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tb.Close()
+
+	// Only the mating moves are returned.
+	b := dragontoothmg.ParseFen("k7/7Q/1K6/8/8/8/8/8 w - - 0 1")
+	moves, err := tb.ProbeRoot(&b)
+	if err != nil || len(moves) == 0 {
+		t.Fatal("No root moves:", err)
+	}
+	foundB7 := false
+	for _, m := range moves {
+		if m.DTZ != 1 || m.WDL != Win {
+			t.Error("Non-mating move returned:", m.Move.String(), m.DTZ)
+		}
+		unapply := b.Apply(m.Move)
+		if !b.OurKingInCheck() || len(b.GenerateLegalMoves()) != 0 {
+			t.Error("Non-mating move returned:", m.Move.String())
+		}
+		unapply()
+		foundB7 = foundB7 || m.Move.String() == "h7b7"
+	}
+	if !foundB7 {
+		t.Error("Qb7 mate not found")
+	}
+
+	// Moves that hang the queen are not returned, and late in the 50-move count
+	// the win is cursed.
+	for _, clock := range []uint8{0, 90} {
+		b = dragontoothmg.ParseFen("8/8/4k3/8/8/8/8/K6Q w - - 0 1")
+		b.Halfmoveclock = clock
+		moves, err = tb.ProbeRoot(&b)
+		if err != nil || len(moves) == 0 {
+			t.Fatal("No root moves:", err)
+		}
+		for _, m := range moves {
+			expected := Win
+			if clock == 90 {
+				expected = CursedWin
+			}
+			if m.DTZ != 13 || m.WDL != expected {
+				t.Error("Wrong root move", m.Move.String(), m.DTZ, m.WDL)
+			}
+			if m.Move.String() == "h1d5" {
+				t.Error("Returned a move that hangs the queen")
+			}
+		}
+	}
+}
+
+// A blessed loss still ranks below a draw when its DTZ is large, as in 7-piece tables.
+func TestProbeRootLongBlessedLoss(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syzygy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	b := dragontoothmg.ParseFen("8/8/8/8/8/8/8/KRk5 w - - 0 1")
+	pieces := []uint8{6, 4, 14}
+	// With the rook's side to move, every position is a cursed win 1301 plies from
+	// zeroing; with the other side to move, a blessed loss.
+	wdl := singleValueTable(newTable(&b, false), pieces, 0, [2]uint8{3, 1}, [4][]uint16{})
+	dtz := singleValueTable(newTable(&b, true), pieces, flagMapped|flagWide, [2]uint8{0},
+		[4][]uint16{{0}, {0}, {600}, {0}})
+	if ioutil.WriteFile(filepath.Join(dir, "KRvK.rtbw"), wdl, 0644) != nil ||
+		ioutil.WriteFile(filepath.Join(dir, "KRvK.rtbz"), dtz, 0644) != nil {
+		t.Fatal("Failed to write the tables")
+	}
+	tb, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tb.Close()
+
+	// Ka2 keeps the blessed loss, and Kxb1 draws.
+	b = dragontoothmg.ParseFen("7k/8/8/8/8/8/8/Kr6 w - - 0 1")
+	moves, err := tb.ProbeRoot(&b)
+	if err != nil || len(moves) != 1 {
+		t.Fatal("Wrong root moves:", moves, err)
+	}
+	if moves[0].Move.String() != "a1b1" || moves[0].WDL != Draw || moves[0].DTZ != 0 {
+		t.Error("Wrong root move", moves[0].Move.String(), moves[0].WDL, moves[0].DTZ)
+	}
+}
+
+// Probes real tables: the KQvK and KRvK tables in testdata (see testdata/README.md),
+// or the tables in the directories in SYZYGY_PATH. Every KQvK and KRvK position is
+// checked against a retrograde analysis done with the move generator.
+func TestRealTables(t *testing.T) {
+	dirs := []string{"testdata"}
+	if path := os.Getenv("SYZYGY_PATH"); path != "" {
+		dirs = filepath.SplitList(path)
+	}
+	for _, name := range []string{"KQvK.rtbw", "KQvK.rtbz", "KRvK.rtbw", "KRvK.rtbz"} {
+		found := false
+		for _, dir := range dirs {
+			if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+				found = true
+			}
+		}
+		if !found {
+			t.Skipf("Missing real table %v; see testdata/README.md", name)
+		}
+	}
+	tb, err := Open(dirs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tb.Close()
+	for _, piece := range []dragontoothmg.Piece{dragontoothmg.Queen, dragontoothmg.Rook} {
+		checkAgainstRetrograde(t, tb, piece)
+	}
+
+	if os.Getenv("SYZYGY_PATH") == "" {
+		return
+	}
+	probes := []struct {
+		fen string
+		wdl WDL
+	}{
+		{"8/8/4k3/8/8/8/8/K6Q w - - 0 1", Win},
+		{"8/8/4k3/8/8/8/8/K6Q b - - 0 1", Loss},
+		{"8/8/8/4k3/8/8/8/R3K3 b - - 0 1", Loss},
+		{"8/8/8/8/8/2k5/8/K1n1B3 w - - 0 1", Draw},
+	}
+	for _, p := range probes {
+		b := dragontoothmg.ParseFen(p.fen)
+		if wdl, err := tb.ProbeWDL(&b); err != nil || wdl != p.wdl {
+			t.Error("Wrong result", wdl, "for", p.fen, err)
+		}
+	}
+}
+
+// Checks the WDL and DTZ of every position with a white king and piece against a
+// black king. In these endings the only zeroing move is the capture of the piece,
+// which draws, so the DTZ of a win or loss is its distance to mate.
+func checkAgainstRetrograde(t *testing.T, tb *Tablebase, piece dragontoothmg.Piece) {
+	mate := retrogradeMate(piece)
+	for idx, plies := range mate {
+		b, ok := retrogradeBoard(piece, idx)
+		if !ok {
+			continue
+		}
+		expected := Draw
+		if plies >= 0 && plies%2 == 1 {
+			expected = Win
+		} else if plies >= 0 {
+			expected = Loss
+		}
+		if wdl, err := tb.ProbeWDL(&b); err != nil || wdl != expected {
+			t.Fatal("Wrong result", wdl, "instead of", expected, "for", b.ToFen(), err)
+		}
+		if plies == 0 { // already mated
+			continue
+		}
+		dtz, err := tb.ProbeDTZ(&b)
+		if expected == Loss {
+			dtz = -dtz
+		}
+		// Tables that store whole moves round the distance up to an odd number of plies.
+		if err != nil || (expected == Draw && dtz != 0) ||
+			(expected != Draw && dtz != plies && dtz != plies+1) {
+			t.Fatal("Wrong DTZ", dtz, "for", b.ToFen(), "which is mate in", plies, "plies", err)
+		}
+	}
+}
+
+// Returns the board for an index of retrogradeMate, and false if it is not a legal
+// position: the white king, white piece and black king are on idx/2/64/64, idx/2/64%64
+// and idx/2%64, and white is to move if idx is even.
+func retrogradeBoard(piece dragontoothmg.Piece, idx int) (dragontoothmg.Board, bool) {
+	wk, wp, bk := dragontoothmg.Square(idx/2/64/64), dragontoothmg.Square(idx/2/64%64), dragontoothmg.Square(idx/2%64)
+	var b dragontoothmg.Board
+	if wk == wp || wk == bk || wp == bk || dragontoothmg.KingAttacks(wk)&(uint64(1)<<bk) != 0 {
+		return b, false
+	}
+	letters := map[dragontoothmg.Square]byte{wk: 'K', wp: "?PNBRQ"[piece], bk: 'k'}
+	var fen []byte
+	for rank := 7; rank >= 0; rank-- {
+		empty := byte(0)
+		for file := 0; file < 8; file++ {
+			if c, ok := letters[dragontoothmg.Square(rank*8+file)]; ok {
+				if empty > 0 {
+					fen = append(fen, '0'+empty)
+				}
+				fen, empty = append(fen, c), 0
+			} else {
+				empty++
+			}
+		}
+		if empty > 0 {
+			fen = append(fen, '0'+empty)
+		}
+		if rank > 0 {
+			fen = append(fen, '/')
+		}
+	}
+	mover, other := " w - - 0 1", " b - - 0 1"
+	if idx%2 != 0 {
+		mover, other = other, mover
+	}
+	// The side not to move may not be in check.
+	b = dragontoothmg.ParseFen(string(fen) + other)
+	inCheck := b.OurKingInCheck()
+	b = dragontoothmg.ParseFen(string(fen) + mover)
+	return b, !inCheck
+}
+
+// Solves the ending of a white king and piece against a black king by retrograde
+// analysis. Returns the number of plies to mate with perfect play for each index
+// (see retrogradeBoard), or -1 for draws and illegal positions.
+func retrogradeMate(piece dragontoothmg.Piece) []int {
+	const positions = 64 * 64 * 64 * 2
+	mate := make([]int, positions)
+	successors := make([][]int32, positions) // -1 for a capture of the piece
+	for idx := range mate {
+		mate[idx] = -1
+		b, ok := retrogradeBoard(piece, idx)
+		if !ok {
+			continue
+		}
+		moves := b.GenerateLegalMoves()
+		if len(moves) == 0 && b.OurKingInCheck() {
+			mate[idx] = 0
+		}
+		for _, m := range moves {
+			unapply := b.Apply(m)
+			next := int32(-1)
+			if b.White.All&^b.White.Kings != 0 {
+				wk, bk := bits.TrailingZeros64(b.White.Kings), bits.TrailingZeros64(b.Black.Kings)
+				wp := bits.TrailingZeros64(b.White.All &^ b.White.Kings)
+				next = int32(((wk*64+wp)*64+bk)*2 + idx%2 ^ 1)
+			}
+			unapply()
+			successors[idx] = append(successors[idx], next)
+		}
+	}
+	// A position is won in n plies if a move reaches a loss in n-1 plies, and lost in n
+	// plies if every move reaches a win in fewer than n. Positions are resolved in order
+	// of distance, so the first pass that changes nothing ends the analysis.
+	for n, changed := 1, true; changed; n++ {
+		changed = false
+		for idx, moves := range successors {
+			if mate[idx] >= 0 || len(moves) == 0 {
+				continue
+			}
+			resolved := n%2 == 0
+			for _, next := range moves {
+				if n%2 == 1 && next >= 0 && mate[next] == n-1 {
+					resolved = true
+					break
+				}
+				if n%2 == 0 && (next < 0 || mate[next] < 0 || mate[next] >= n || mate[next]%2 == 0) {
+					resolved = false
+					break
+				}
+			}
+			if resolved {
+				mate[idx] = n
+				changed = true
+			}
+		}
+	}
+	return mate
+}
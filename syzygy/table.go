@@ -0,0 +1,500 @@
+package syzygy
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/bits"
+
+	"github.com/dylhunn/dragontoothmg"
+)
+
+// Flags of each part of a table.
+const (
+	flagSTM         = 1 // the side to move stored by a DTZ table
+	flagMapped      = 2 // DTZ values are remapped through the table's map
+	flagWinPlies    = 4 // DTZ values of wins are stored in plies, not moves
+	flagLossPlies   = 8 // DTZ values of losses are stored in plies, not moves
+	flagWide        = 16
+	flagSingleValue = 128 // every position stores the same value
+)
+
+var (
+	wdlMagic = [4]byte{0x71, 0xe8, 0x23, 0x5d}
+	dtzMagic = [4]byte{0xd7, 0x66, 0x0c, 0xa5}
+)
+
+// Indexing and decompression information for a part of a table. A table has one part
+// for each side to move (WDL tables only) and each file of the lead pawn (tables with
+// pawns only).
+type pairsData struct {
+	flags       uint8
+	maxSymLen   int
+	minSymLen   int // also the stored value, for single value tables
+	numBlocks   uint32
+	sizeofBlock uint64
+	span        uint64 // there is a sparse index entry about every span values
+
+	lowestSym []uint16 // lowestSym[l] is the symbol of length l+minSymLen with the lowest value
+	base64    []uint64 // base64[l] is the lowest symbol of length l+minSymLen, padded to 64 bits
+	btree     []byte   // 3 bytes per symbol: the left and right symbols it expands to
+	symlen    []uint8  // the number of values, minus one, represented by each symbol
+
+	sparseIndexOffset int64 // 6 bytes per entry: a block number and an offset within it
+	sparseIndexSize   uint64
+	blockLengthOffset int64 // 2 bytes per block: the number of values in it, minus one
+	blockLengthSize   uint32
+	dataOffset        int64
+
+	pieces   [maxPieces]uint8      // the order in which pieces are encoded
+	groupIdx [maxPieces + 1]uint64 // the factor of each group in the index
+	groupLen [maxPieces + 1]int    // the number of pieces in each group, zero-terminated
+	mapIdx   [4]uint16             // offsets into the DTZ map for Win, Loss, CursedWin and BlessedLoss
+}
+
+// A WDL or DTZ table file. It is read lazily, so that only the parts that are probed
+// need to be loaded.
+type table struct {
+	r      io.ReaderAt
+	closer io.Closer
+	dtz    bool
+
+	key, key2       uint64 // material keys with the stronger side as white, and as black
+	pieceCount      int
+	hasPawns        bool
+	hasUniquePieces bool
+	pawnCount       [2]int // for the lead color, and the other one
+
+	items  [2][4]pairsData // [side to move][file of the lead pawn]
+	dtzMap []byte
+}
+
+func (t *table) get(stm int, file int) *pairsData {
+	if t.dtz {
+		stm = 0
+	}
+	if !t.hasPawns {
+		file = 0
+	}
+	return &t.items[stm][file]
+}
+
+// Whether a DTZ table stores positions with the given side to move.
+func (t *table) dtzStoresSide(stm int, file int) bool {
+	return int(t.get(0, file).flags&flagSTM) == stm || (t.key == t.key2 && !t.hasPawns)
+}
+
+// Sets up a table for the material of the given board, before reading its file.
+func newTable(b *dragontoothmg.Board, dtz bool) *table {
+	t := &table{dtz: dtz}
+	t.key = materialKey(b)
+	t.key2 = swapColors(t.key)
+	t.pieceCount = bits.OnesCount64(b.White.All | b.Black.All)
+	t.hasPawns = b.White.Pawns|b.Black.Pawns != 0
+	for _, bb := range []*dragontoothmg.Bitboards{&b.White, &b.Black} {
+		for _, pieces := range []uint64{bb.Pawns, bb.Knights, bb.Bishops, bb.Rooks, bb.Queens} {
+			if bits.OnesCount64(pieces) == 1 {
+				t.hasUniquePieces = true
+			}
+		}
+	}
+	// Tables are stored with the stronger side as white. The lead color is the one
+	// with fewer pawns, if both sides have them.
+	strong, weak := bits.OnesCount64(b.White.Pawns), bits.OnesCount64(b.Black.Pawns)
+	if !whiteIsStronger(b) {
+		strong, weak = weak, strong
+		t.key, t.key2 = t.key2, t.key
+	}
+	if weak == 0 || (strong > 0 && weak >= strong) {
+		t.pawnCount = [2]int{strong, weak}
+	} else {
+		t.pawnCount = [2]int{weak, strong}
+	}
+	return t
+}
+
+// A reader of the table file that keeps track of its position.
+type cursor struct {
+	r   io.ReaderAt
+	off int64
+	err error
+}
+
+func (c *cursor) bytes(n int) []byte {
+	buf := make([]byte, n)
+	if c.err == nil {
+		_, c.err = c.r.ReadAt(buf, c.off)
+	}
+	c.off += int64(n)
+	return buf
+}
+
+func (c *cursor) byte() uint8 {
+	return c.bytes(1)[0]
+}
+
+func (c *cursor) uint16() uint16 {
+	return binary.LittleEndian.Uint16(c.bytes(2))
+}
+
+func (c *cursor) uint32() uint32 {
+	return binary.LittleEndian.Uint32(c.bytes(4))
+}
+
+// Skips to the next multiple of n bytes.
+func (c *cursor) align(n int64) {
+	c.off = (c.off + n - 1) / n * n
+}
+
+// Reads the header of a table file and sets up the parts of the table.
+func (t *table) read(r io.ReaderAt, size int64) error {
+	t.r = r
+	if size%64 != 16 {
+		return errors.New("Invalid Syzygy table: bad file size")
+	}
+	c := &cursor{r: r}
+	magic := wdlMagic
+	if t.dtz {
+		magic = dtzMagic
+	}
+	if m := c.bytes(4); c.err == nil && string(m) != string(magic[:]) {
+		return errors.New("Invalid Syzygy table: bad magic number")
+	}
+	const (
+		split    = 1
+		hasPawns = 2
+	)
+	flags := c.byte()
+	if c.err == nil && ((flags&hasPawns != 0) != t.hasPawns || (flags&split != 0) != (t.key != t.key2)) {
+		return errors.New("Invalid Syzygy table: wrong material")
+	}
+
+	sides := 1
+	if !t.dtz && t.key != t.key2 {
+		sides = 2
+	}
+	maxFile := 0
+	if t.hasPawns {
+		maxFile = 3
+	}
+	pp := t.hasPawns && t.pawnCount[1] > 0 // pawns on both sides
+
+	for f := 0; f <= maxFile; f++ {
+		first := c.byte()
+		second := uint8(0xff)
+		if pp {
+			second = c.byte()
+		}
+		order := [2][2]int{{int(first & 0xf), int(second & 0xf)}, {int(first >> 4), int(second >> 4)}}
+		for k := 0; k < t.pieceCount; k++ {
+			p := c.byte()
+			for i := 0; i < sides; i++ {
+				if i == 0 {
+					t.get(i, f).pieces[k] = p & 0xf
+				} else {
+					t.get(i, f).pieces[k] = p >> 4
+				}
+			}
+		}
+		for i := 0; i < sides; i++ {
+			t.setGroups(t.get(i, f), order[i], f)
+		}
+	}
+	c.align(2)
+
+	for f := 0; f <= maxFile; f++ {
+		for i := 0; i < sides; i++ {
+			t.get(i, f).readSizes(c)
+		}
+	}
+
+	if t.dtz {
+		mapStart := c.off
+		for f := 0; f <= maxFile; f++ {
+			d := t.get(0, f)
+			if d.flags&flagMapped == 0 {
+				continue
+			}
+			if d.flags&flagWide != 0 {
+				c.align(2)
+				for i := 0; i < 4; i++ {
+					d.mapIdx[i] = uint16((c.off-mapStart)/2 + 1)
+					c.off += 2 * int64(c.uint16())
+				}
+			} else {
+				for i := 0; i < 4; i++ {
+					d.mapIdx[i] = uint16(c.off - mapStart + 1)
+					c.off += int64(c.byte())
+				}
+			}
+		}
+		c.align(2)
+		t.dtzMap = make([]byte, c.off-mapStart)
+		if c.err == nil {
+			_, c.err = r.ReadAt(t.dtzMap, mapStart)
+		}
+	}
+
+	for f := 0; f <= maxFile; f++ {
+		for i := 0; i < sides; i++ {
+			d := t.get(i, f)
+			d.sparseIndexOffset = c.off
+			c.off += int64(d.sparseIndexSize) * 6
+		}
+	}
+	for f := 0; f <= maxFile; f++ {
+		for i := 0; i < sides; i++ {
+			d := t.get(i, f)
+			d.blockLengthOffset = c.off
+			c.off += int64(d.blockLengthSize) * 2
+		}
+	}
+	for f := 0; f <= maxFile; f++ {
+		for i := 0; i < sides; i++ {
+			c.align(64)
+			d := t.get(i, f)
+			d.dataOffset = c.off
+			c.off += int64(d.numBlocks) * int64(d.sizeofBlock)
+			if d.numBlocks > 0 && c.off > size && c.err == nil {
+				c.err = errors.New("Invalid Syzygy table: file is truncated")
+			}
+		}
+	}
+	return c.err
+}
+
+// Groups the pieces that are encoded together, and computes the factor of each group
+// in the index. A group contains pieces of the same type and color, except for the
+// lead group which holds the lead pawns, three unique pieces, or the two kings.
+// For example, KRvKN is grouped as KRK + N, KNNvK as KK + NN, and KPPvKP as P + PP + K + K.
+func (t *table) setGroups(d *pairsData, order [2]int, file int) {
+	n := 0
+	firstLen := 2
+	if t.hasPawns {
+		firstLen = 0
+	} else if t.hasUniquePieces {
+		firstLen = 3
+	}
+	d.groupLen[0] = 1
+	for i := 1; i < t.pieceCount; i++ {
+		firstLen--
+		if firstLen > 0 || d.pieces[i] == d.pieces[i-1] {
+			d.groupLen[n]++
+		} else {
+			n++
+			d.groupLen[n] = 1
+		}
+	}
+	n++
+	d.groupLen[n] = 0
+
+	// The groups are encoded in the order given by the table, where order[0] is the
+	// position of the lead group and order[1] that of the remaining pawns.
+	pp := t.hasPawns && t.pawnCount[1] > 0
+	next := 1
+	freeSquares := 64 - d.groupLen[0]
+	if pp {
+		next = 2
+		freeSquares -= d.groupLen[1]
+	}
+	idx := uint64(1)
+	for k := 0; next < n || k == order[0] || k == order[1]; k++ {
+		if k == order[0] {
+			d.groupIdx[0] = idx
+			if t.hasPawns {
+				idx *= leadPawnsSize[d.groupLen[0]][file]
+			} else if t.hasUniquePieces {
+				idx *= 31332
+			} else {
+				idx *= 462
+			}
+		} else if k == order[1] {
+			d.groupIdx[1] = idx
+			idx *= binomial[d.groupLen[1]][48-d.groupLen[0]]
+		} else {
+			d.groupIdx[next] = idx
+			idx *= binomial[d.groupLen[next]][freeSquares]
+			freeSquares -= d.groupLen[next]
+			next++
+		}
+	}
+	d.groupIdx[n] = idx
+}
+
+// Reads the sizes of the compressed data and the Huffman code of a part of a table.
+func (d *pairsData) readSizes(c *cursor) {
+	d.flags = c.byte()
+	if d.flags&flagSingleValue != 0 {
+		d.minSymLen = int(c.byte()) // the single value
+		return
+	}
+
+	n := 0
+	for d.groupLen[n] != 0 {
+		n++
+	}
+	tbSize := d.groupIdx[n]
+
+	d.sizeofBlock = 1 << c.byte()
+	d.span = 1 << c.byte()
+	d.sparseIndexSize = (tbSize + d.span - 1) / d.span
+	padding := c.byte()
+	d.numBlocks = c.uint32()
+	d.blockLengthSize = d.numBlocks + uint32(padding) // so that the sparse index stays in range
+	d.maxSymLen = int(c.byte())
+	d.minSymLen = int(c.byte())
+	if d.maxSymLen < d.minSymLen || d.minSymLen == 0 {
+		if c.err == nil {
+			c.err = errors.New("Invalid Syzygy table: bad symbol lengths")
+		}
+		return
+	}
+
+	// The canonical Huffman code has longer symbols with lower values, so that the
+	// symbol length can be found by comparing against the lowest symbol of each length.
+	count := d.maxSymLen - d.minSymLen + 1
+	d.lowestSym = make([]uint16, count)
+	for i := range d.lowestSym {
+		d.lowestSym[i] = c.uint16()
+	}
+	d.base64 = make([]uint64, count)
+	for i := count - 2; i >= 0; i-- {
+		d.base64[i] = (d.base64[i+1] + uint64(d.lowestSym[i]) - uint64(d.lowestSym[i+1])) / 2
+	}
+	for i := range d.base64 {
+		d.base64[i] <<= uint(64 - i - d.minSymLen)
+	}
+
+	symbols := int(c.uint16())
+	d.btree = c.bytes(3 * symbols)
+	c.off += int64(symbols & 1)
+
+	// Each symbol expands to a pair of symbols (Recursive Pairing), down to the values.
+	d.symlen = make([]uint8, symbols)
+	visited := make([]bool, symbols)
+	for sym := 0; sym < symbols; sym++ {
+		if !visited[sym] {
+			d.symlen[sym] = d.setSymlen(sym, visited)
+		}
+	}
+}
+
+func (d *pairsData) left(sym int) int {
+	return int(d.btree[3*sym+1]&0xf)<<8 | int(d.btree[3*sym])
+}
+
+func (d *pairsData) right(sym int) int {
+	return int(d.btree[3*sym+2])<<4 | int(d.btree[3*sym+1]>>4)
+}
+
+func (d *pairsData) setSymlen(sym int, visited []bool) uint8 {
+	visited[sym] = true
+	sr := d.right(sym)
+	if sr == 0xfff {
+		return 0
+	}
+	sl := d.left(sym)
+	if sl >= len(d.symlen) || sr >= len(d.symlen) {
+		return 0 // corrupt table
+	}
+	if !visited[sl] {
+		d.symlen[sl] = d.setSymlen(sl, visited)
+	}
+	if !visited[sr] {
+		d.symlen[sr] = d.setSymlen(sr, visited)
+	}
+	return d.symlen[sl] + d.symlen[sr] + 1
+}
+
+func (t *table) blockLength(d *pairsData, block uint32) (int, error) {
+	var buf [2]byte
+	if _, err := t.r.ReadAt(buf[:], d.blockLengthOffset+2*int64(block)); err != nil {
+		return 0, err
+	}
+	return int(binary.LittleEndian.Uint16(buf[:])), nil
+}
+
+// Returns the value stored at the given index of a part of a table.
+func (t *table) decompress(d *pairsData, idx uint64) (int, error) {
+	if d.flags&flagSingleValue != 0 {
+		return d.minSymLen, nil
+	}
+
+	// Find the block holding the value, starting from the nearest sparse index entry,
+	// which points to the value at k*span + span/2.
+	k := idx / d.span
+	var entry [6]byte
+	if _, err := t.r.ReadAt(entry[:], d.sparseIndexOffset+6*int64(k)); err != nil {
+		return 0, err
+	}
+	block := binary.LittleEndian.Uint32(entry[0:4])
+	offset := int(binary.LittleEndian.Uint16(entry[4:6]))
+	offset += int(idx%d.span) - int(d.span/2)
+	for offset < 0 {
+		block--
+		length, err := t.blockLength(d, block)
+		if err != nil {
+			return 0, err
+		}
+		offset += length + 1
+	}
+	for {
+		length, err := t.blockLength(d, block)
+		if err != nil {
+			return 0, err
+		}
+		if offset <= length {
+			break
+		}
+		offset -= length + 1
+		block++
+	}
+
+	buf := make([]byte, d.sizeofBlock+8)
+	if n, err := t.r.ReadAt(buf[:d.sizeofBlock], d.dataOffset+int64(block)*int64(d.sizeofBlock)); n == 0 && err != nil {
+		return 0, err
+	}
+
+	// Decode the symbols of the block until reaching the one that holds our value.
+	buf64 := binary.BigEndian.Uint64(buf)
+	ptr := 8
+	buf64Size := 64
+	var sym int
+	for {
+		l := 0
+		for l < len(d.base64)-1 && buf64 < d.base64[l] {
+			l++
+		}
+		sym = int((buf64-d.base64[l])>>uint(64-l-d.minSymLen)) + int(d.lowestSym[l])
+		if sym >= len(d.symlen) {
+			return 0, errors.New("Invalid Syzygy table: bad symbol")
+		}
+		if offset < int(d.symlen[sym])+1 {
+			break
+		}
+		offset -= int(d.symlen[sym]) + 1
+		l += d.minSymLen
+		buf64 <<= uint(l)
+		buf64Size -= l
+		if buf64Size <= 32 {
+			if ptr+4 > len(buf) {
+				return 0, errors.New("Invalid Syzygy table: block overrun")
+			}
+			buf64Size += 32
+			buf64 |= uint64(binary.BigEndian.Uint32(buf[ptr:])) << uint(64-buf64Size)
+			ptr += 4
+		}
+	}
+
+	// Expand the symbol into its pair of symbols until reaching the value.
+	for d.symlen[sym] != 0 {
+		left := d.left(sym)
+		if offset < int(d.symlen[left])+1 {
+			sym = left
+		} else {
+			offset -= int(d.symlen[left]) + 1
+			sym = d.right(sym)
+		}
+	}
+	return d.left(sym), nil
+}
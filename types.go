@@ -24,6 +24,11 @@ type Board struct {
 	Black         Bitboards
 	pieces        [64]Piece // maps position->piece-type
 	hash          uint64
+	castleRooks   [4]uint8 // starting squares of the castling rooks, indexed like the castlerights bits
+	// If set, castling moves are encoded as the king capturing its own rook (as in UCI_Chess960),
+	// and FEN castling rights name the rook file when the rook is not the outermost one.
+	// ParseFen sets this automatically for positions that are not standard chess positions.
+	Chess960 bool
 }
 
 func bitSet(bits uint64, pos uint8) bool {
@@ -84,8 +89,14 @@ func (b *Board) movePiece(piece Piece, destPiece Piece, from uint8, to uint8, pi
 
 // Return the Zobrist hash value for the board.
 // The hash value does NOT change with the turn number, nor the draw move counter.
-// All other elements of the Board type affect the hash.
+// It is not a full-position key either: the squares of the castling rooks and the
+// Chess960 flag are not hashed, so boards that differ only in them share a hash.
+// Both are fixed for the length of a game, so positions within one game only share
+// a hash if they are equal. The piece placement, side to move, castling rights and
+// en passant square all affect the hash.
 // This function is cheap to call, since the hash is incrementally updated.
+// Hashes are the same in every process, so they may be stored, as long as
+// ZobristVersion is stored with them.
 func (b *Board) Hash() uint64 {
 	//b.hash = recomputeBoardHash(b)
 	return b.hash
@@ -103,6 +114,78 @@ func (b *Board) Enpassant() uint8 {
 // This just indicates whether castling rights have been lost, not whether
 // castling is actually possible.
 
+// The default castling rook squares of standard chess, indexed like the castlerights bits.
+var standardCastleRooks = [4]uint8{0, 7, 56, 63}
+
+// Index into castleRooks (and bit of castlerights) for a castling right.
+func castleIndex(white bool, kingside bool) uint8 {
+	var idx uint8
+	if !white {
+		idx = 2
+	}
+	if kingside {
+		idx++
+	}
+	return idx
+}
+
+// Returns the starting square of the rook for the given castling right.
+func (b *Board) castleRookSquare(white bool, kingside bool) uint8 {
+	return b.castleRooks[castleIndex(white, kingside)]
+}
+
+// Returns whether the move is a castling move, and if so, whether it is kingside.
+// Castling may be encoded as the king moving two squares (standard), or as the king
+// capturing its own rook (Chess960). The move must be legal.
+func (b *Board) isCastle(m Move) (isCastle bool, kingside bool) {
+	if b.pieces[m.From()] != King {
+		return false, false
+	}
+	var ourRooks uint64
+	if b.isWhitePieceAt(m.From()) {
+		ourRooks = b.White.Rooks
+	} else {
+		ourRooks = b.Black.Rooks
+	}
+	if bitSet(ourRooks, m.To()) || m.To()-m.From() == 2 || int(m.To())-int(m.From()) == -2 {
+		return true, m.To() > m.From()
+	}
+	return false, false
+}
+
+// Returns the move with the flags and pieces that the move generator would record for
+// it in this position, ignoring any flags it already has. The move must be legal.
+// This is useful for moves from ParseMove, or from a hash table that stores only
+// the low 16 bits of each move.
+func (b *Board) FlagMove(m Move) Move {
+	m = m.Base()
+	from, to := m.From(), m.To()
+	moved := b.pieces[from]
+	m |= Move(moved) << movedPieceShift
+	if castle, _ := b.isCastle(m); castle {
+		return m | castleMoveFlag
+	}
+	captured := b.pieces[to]
+	if moved == Pawn {
+		if to == b.enpassant && b.enpassant != 0 {
+			m |= enPassantMoveFlag
+			captured = Pawn
+		} else if to-from == 16 || from-to == 16 {
+			m |= doublePushMoveFlag
+		}
+	}
+	if captured != Nothing {
+		m |= captureMoveFlag | Move(captured)<<capturedPieceShift
+	}
+	return m
+}
+
+// Whether the given side still has the right to castle on the given side of the board.
+// This does not mean that castling is currently legal.
+func (b *Board) CanCastle(white bool, kingside bool) bool {
+	return b.castlerights&(1<<castleIndex(white, kingside)) != 0
+}
+
 // Castling helper functions for all 16 possible scenarios
 func (b *Board) whiteCanCastleQueenside() bool {
 	return b.castlerights&1 == 1
@@ -236,9 +319,29 @@ func (bb *Bitboards) pieceBitboard(piece Piece) *uint64 {
 // 6 bits: destination square
 // 6 bits: source square
 // 3 bits: promotion
+// 1 bit: unused
+// 4 bits: flags (capture, en passant, castling, double pawn push)
+// 3 bits: moved piece
+// 3 bits: captured piece (a pawn for en passant)
+// The low 16 bits are all that ParseMove and the UCI notation record. The flags and
+// pieces are set by the move generator, or by Board.FlagMove.
 
 // Move bitwise structure; internal implementation is private.
-type Move uint16
+//
+// Breaking change: generated moves carry flags and pieces in their high bits, so a
+// generated move is no longer == to the same move from ParseMove, a hash table or an
+// older version of this library. This compiles but is silently false. Compare moves
+// from different sources with Move.Base, or flag a parsed move with Board.FlagMove.
+type Move uint32
+
+const (
+	captureMoveFlag    Move = 1 << 16
+	enPassantMoveFlag  Move = 1 << 17
+	castleMoveFlag     Move = 1 << 18
+	doublePushMoveFlag Move = 1 << 19
+	movedPieceShift         = 20
+	capturedPieceShift      = 23
+)
 
 func (m *Move) To() uint8 {
 	return uint8(*m & 0x3F)
@@ -263,10 +366,48 @@ func (m *Move) Setpromote(p Piece) *Move {
 	*m = *m & ^(Move(0x7000)) | (Move(p) << 12)
 	return m
 }
+
+// Returns the move without its flags, as ParseMove would return it. Moves from
+// different sources (such as a hash table and the move generator) should be
+// compared this way, since only generated moves have flags.
+func (m *Move) Base() Move {
+	return *m & 0xFFFF
+}
+
+// Whether the move captures a piece, including en passant. Only valid for moves with flags.
+func (m *Move) IsCapture() bool {
+	return *m&captureMoveFlag != 0
+}
+
+// Whether the move is an en passant capture. Only valid for moves with flags.
+func (m *Move) IsEnPassant() bool {
+	return *m&enPassantMoveFlag != 0
+}
+
+// Whether the move is castling. Only valid for moves with flags.
+func (m *Move) IsCastle() bool {
+	return *m&castleMoveFlag != 0
+}
+
+// Whether the move pushes a pawn by two squares. Only valid for moves with flags.
+func (m *Move) IsDoublePush() bool {
+	return *m&doublePushMoveFlag != 0
+}
+
+// The type of the piece that moves, or Nothing if the move has no flags.
+func (m *Move) MovedPiece() Piece {
+	return Piece((*m >> movedPieceShift) & 0x7)
+}
+
+// The type of the captured piece, or Nothing if the move is not a capture or has no flags.
+func (m *Move) CapturedPiece() Piece {
+	return Piece((*m >> capturedPieceShift) & 0x7)
+}
+
 func (m *Move) String() string {
 	/*return fmt.Sprintf("[from: %v, to: %v, promote: %v]",
 	IndexToAlgebraic(Square(m.From())), IndexToAlgebraic(Square(m.To())), m.Promote())*/
-	if *m == 0 {
+	if m.Base() == 0 {
 		return "0000"
 	}
 	result := IndexToAlgebraic(Square(m.From())) + IndexToAlgebraic(Square(m.To()))
@@ -284,6 +425,48 @@ func (m *Move) String() string {
 	return result
 }
 
+// A fixed-capacity list of moves, used to generate moves without allocating.
+// It is large enough to hold the moves of any legal position.
+type MoveList struct {
+	moves [kMaxMoveListLength]Move
+	count int
+}
+
+// The number of moves in the list.
+func (ml *MoveList) Len() int {
+	return ml.count
+}
+
+// Returns the i-th move in the list.
+func (ml *MoveList) At(i int) Move {
+	return ml.moves[i]
+}
+
+// Returns the moves in the list. The slice refers to the list's own storage,
+// so it is only valid until the list is next modified.
+func (ml *MoveList) Slice() []Move {
+	return ml.moves[:ml.count]
+}
+
+// Removes all moves from the list.
+func (ml *MoveList) Clear() {
+	ml.count = 0
+}
+
+func (ml *MoveList) push(m Move) {
+	ml.moves[ml.count] = m
+	ml.count++
+}
+
+// Selects which moves the generator produces.
+type GenMode uint8
+
+const (
+	GenAll                        GenMode = iota // All legal moves
+	GenCapturesPromosCheckEvasion                // Only captures, promotions, and check evasions, for quiescence search
+	GenQuiets                                    // Only moves that are neither captures nor promotions (including castling), and none in check
+)
+
 // Square index values from 0-63.
 type Square uint8
 
@@ -0,0 +1,307 @@
+package uci
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dylhunn/dragontoothmg"
+)
+
+// Runs the UCI protocol loop, passing searches on to a Searcher.
+type Engine struct {
+	Name     string
+	Author   string
+	Searcher Searcher
+
+	out      io.Writer
+	outMutex sync.Mutex
+	game     *dragontoothmg.Game
+	chess960 bool
+
+	// The search in progress, if any
+	limits   Limits
+	white    bool // the side to move in the search
+	stop     chan struct{}
+	stopOnce *sync.Once
+	timer    *time.Timer
+	done     chan struct{}
+}
+
+// Creates an engine that identifies itself to the GUI with the given name and author.
+func NewEngine(name, author string, searcher Searcher) *Engine {
+	return &Engine{Name: name, Author: author, Searcher: searcher}
+}
+
+// Reads UCI commands from in until "quit" or the end of the input, writing responses to out.
+// Unknown commands are ignored, as the protocol requires. Returns an error only if in
+// cannot be read.
+func (e *Engine) Run(in io.Reader, out io.Writer) error {
+	e.out = out
+	e.game = dragontoothmg.NewGame(dragontoothmg.ParseFen(dragontoothmg.Startpos))
+	defer e.stopSearch()
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "uci":
+			e.println("id name " + e.Name)
+			e.println("id author " + e.Author)
+			e.println(Option{Name: "UCI_Chess960", Type: "check", Default: "false"}.String())
+			for _, option := range e.Searcher.Options() {
+				e.println(option.String())
+			}
+			e.println("uciok")
+		case "isready":
+			e.println("readyok")
+		case "ucinewgame":
+			e.stopSearch()
+			e.Searcher.NewGame()
+			e.game = dragontoothmg.NewGame(e.startpos())
+		case "setoption":
+			e.stopSearch()
+			if err := e.setOption(fields[1:]); err != nil {
+				e.println("info string " + err.Error())
+			}
+		case "position":
+			e.stopSearch()
+			if err := e.setPosition(fields[1:]); err != nil {
+				e.println("info string " + err.Error())
+			}
+		case "go":
+			e.stopSearch()
+			e.goCommand(fields[1:])
+		case "stop":
+			e.stopSearch()
+		case "ponderhit":
+			// The opponent played the expected move, so start the clock.
+			if e.done != nil && e.limits.Ponder {
+				e.limits.Ponder = false
+				e.startTimer()
+			}
+		case "quit":
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+func (e *Engine) println(line string) {
+	e.outMutex.Lock()
+	defer e.outMutex.Unlock()
+	fmt.Fprintln(e.out, line)
+}
+
+func (e *Engine) startpos() dragontoothmg.Board {
+	b := dragontoothmg.ParseFen(dragontoothmg.Startpos)
+	b.Chess960 = e.chess960
+	return b
+}
+
+// Handles "setoption name <name> [value <value>]". Names and values may contain spaces.
+func (e *Engine) setOption(args []string) error {
+	var name, value []string
+	var target *[]string
+	for _, arg := range args {
+		switch {
+		case arg == "name" && target == nil:
+			target = &name
+		case arg == "value" && target == &name:
+			target = &value
+		case target != nil:
+			*target = append(*target, arg)
+		}
+	}
+	if len(name) == 0 {
+		return errors.New("Invalid setoption command: missing name")
+	}
+	optionName, optionValue := strings.Join(name, " "), strings.Join(value, " ")
+	if strings.EqualFold(optionName, "UCI_Chess960") {
+		e.chess960 = optionValue == "true"
+		return nil
+	}
+	return e.Searcher.SetOption(optionName, optionValue)
+}
+
+// Handles "position [startpos | fen <fen>] [moves <move>...]".
+// If a move is invalid, the position is left after the last valid move.
+func (e *Engine) setPosition(args []string) error {
+	if len(args) == 0 {
+		return errors.New("Invalid position command: missing position")
+	}
+	var b dragontoothmg.Board
+	var rest []string
+	switch args[0] {
+	case "startpos":
+		b, rest = e.startpos(), args[1:]
+	case "fen":
+		end := len(args)
+		for i, arg := range args {
+			if arg == "moves" {
+				end = i
+				break
+			}
+		}
+		var err error
+		b, err = dragontoothmg.ParseFenStrict(strings.Join(args[1:end], " "))
+		if err != nil {
+			return err
+		}
+		b.Chess960 = b.Chess960 || e.chess960
+		rest = args[end:]
+	default:
+		return errors.New("Invalid position command: unknown position " + args[0])
+	}
+	e.game = dragontoothmg.NewGame(b)
+	if len(rest) == 0 {
+		return nil
+	}
+	if rest[0] != "moves" {
+		return errors.New("Invalid position command: unexpected " + rest[0])
+	}
+	for _, movestr := range rest[1:] {
+		m, err := e.legalMove(movestr)
+		if err != nil {
+			return err
+		}
+		e.game.Push(m)
+	}
+	return nil
+}
+
+// Parses a move, checking that it is legal in the current position.
+func (e *Engine) legalMove(movestr string) (dragontoothmg.Move, error) {
+	m, err := dragontoothmg.ParseMove(movestr)
+	if err != nil {
+		return 0, err
+	}
+	b := e.game.Board()
+	for _, legal := range b.GenerateLegalMoves() {
+		if legal.Base() == m {
+			return legal, nil
+		}
+	}
+	return 0, errors.New("Illegal move: " + movestr)
+}
+
+// Handles "go", starting a search (or running perft) in the background.
+func (e *Engine) goCommand(args []string) {
+	var limits Limits
+	for i := 0; i < len(args); i++ {
+		next := func() string {
+			if i+1 < len(args) {
+				i++
+				return args[i]
+			}
+			return ""
+		}
+		switch args[i] {
+		case "perft":
+			depth, _ := strconv.Atoi(next())
+			e.perft(depth)
+			return
+		case "depth":
+			limits.Depth, _ = strconv.Atoi(next())
+		case "nodes":
+			limits.Nodes, _ = strconv.ParseInt(next(), 10, 64)
+		case "mate":
+			limits.Mate, _ = strconv.Atoi(next())
+		case "movetime":
+			limits.MoveTime = parseMillis(next())
+		case "wtime":
+			limits.WTime = parseMillis(next())
+		case "btime":
+			limits.BTime = parseMillis(next())
+		case "winc":
+			limits.WInc = parseMillis(next())
+		case "binc":
+			limits.BInc = parseMillis(next())
+		case "movestogo":
+			limits.MovesToGo, _ = strconv.Atoi(next())
+		case "infinite":
+			limits.Infinite = true
+		case "ponder":
+			limits.Ponder = true
+		case "searchmoves":
+			for i+1 < len(args) {
+				m, err := e.legalMove(args[i+1])
+				if err != nil {
+					break
+				}
+				limits.SearchMoves = append(limits.SearchMoves, m)
+				i++
+			}
+		}
+	}
+
+	game := e.game
+	board := game.Board()
+	stop, done := make(chan struct{}), make(chan struct{})
+	e.limits, e.white = limits, board.Wtomove
+	e.stop, e.stopOnce, e.done = stop, &sync.Once{}, done
+	e.startTimer()
+	go func() {
+		defer close(done)
+		best := e.Searcher.Search(game, limits, stop, func(info Info) { e.println(info.String()) })
+		if best == 0 {
+			// The search was stopped before it found a move.
+			if moves := board.GenerateLegalMoves(); len(moves) > 0 {
+				best = moves[0]
+			}
+		}
+		e.println("bestmove " + best.String())
+	}()
+}
+
+// Arranges for the search in progress to stop when its time runs out, if it is timed.
+func (e *Engine) startTimer() {
+	if budget := e.limits.timeBudget(e.white); budget > 0 {
+		stop, once := e.stop, e.stopOnce
+		e.timer = time.AfterFunc(budget, func() { once.Do(func() { close(stop) }) })
+	}
+}
+
+// Stops the search in progress, if any, and waits for it to report its best move.
+func (e *Engine) stopSearch() {
+	if e.done == nil {
+		return
+	}
+	stop := e.stop
+	e.stopOnce.Do(func() { close(stop) })
+	<-e.done
+	if e.timer != nil {
+		e.timer.Stop()
+	}
+	e.stop, e.stopOnce, e.timer, e.done = nil, nil, nil, nil
+}
+
+// Runs perft on the current position, printing the node count below each move.
+func (e *Engine) perft(depth int) {
+	if depth < 1 {
+		depth = 1
+	}
+	b := e.game.Board()
+	var total int64
+	for _, m := range b.GenerateLegalMoves() {
+		unapply := b.Apply(m)
+		count := dragontoothmg.Perft(&b, depth-1)
+		unapply()
+		total += count
+		e.println(m.String() + ": " + strconv.FormatInt(count, 10))
+	}
+	e.println("")
+	e.println("Nodes searched: " + strconv.FormatInt(total, 10))
+}
+
+func parseMillis(str string) time.Duration {
+	ms, _ := strconv.ParseInt(str, 10, 64)
+	return time.Duration(ms) * time.Millisecond
+}
@@ -0,0 +1,179 @@
+package uci
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dylhunn/dragontoothmg"
+)
+
+// A searcher that records what it was asked, and plays the first legal move.
+type fakeSearcher struct {
+	newGames int
+	options  map[string]string
+	fens     []string
+	limits   []Limits
+}
+
+func (s *fakeSearcher) NewGame() {
+	s.newGames++
+}
+
+func (s *fakeSearcher) Options() []Option {
+	return []Option{
+		{Name: "Hash", Type: "spin", Default: "16", Min: 1, Max: 1024},
+		{Name: "Style", Type: "combo", Default: "Normal", Vars: []string{"Solid", "Normal"}},
+	}
+}
+
+func (s *fakeSearcher) SetOption(name, value string) error {
+	if name != "Hash" && name != "Style" {
+		return errors.New("Unknown option " + name)
+	}
+	s.options[name] = value
+	return nil
+}
+
+func (s *fakeSearcher) Search(game *dragontoothmg.Game, limits Limits, stop <-chan struct{}, info func(Info)) dragontoothmg.Move {
+	b := game.Board()
+	s.fens = append(s.fens, b.ToFen())
+	s.limits = append(s.limits, limits)
+	if limits.Infinite || limits.MoveTime > 0 {
+		<-stop
+	}
+	moves := b.GenerateLegalMoves()
+	info(Info{Depth: 1, Score: 25, Nodes: 20, PV: moves[:1], Message: "fake"})
+	return moves[0]
+}
+
+func runEngine(t *testing.T, s *fakeSearcher, input string) []string {
+	var out strings.Builder
+	engine := NewEngine("Test", "Tester", s)
+	if err := engine.Run(strings.NewReader(input), &out); err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(out.String()), "\n")
+}
+
+func TestHandshake(t *testing.T) {
+	s := &fakeSearcher{options: map[string]string{}}
+	lines := runEngine(t, s, "uci\nisready\nsetoption name Hash value 64\nsetoption name Style value Solid\nucinewgame\nquit\n")
+	expected := []string{
+		"id name Test",
+		"id author Tester",
+		"option name UCI_Chess960 type check default false",
+		"option name Hash type spin default 16 min 1 max 1024",
+		"option name Style type combo default Normal var Solid var Normal",
+		"uciok",
+		"readyok",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Error("Wrong handshake:\n" + strings.Join(lines, "\n"))
+	}
+	if s.options["Hash"] != "64" || s.options["Style"] != "Solid" || s.newGames != 1 {
+		t.Error("Options or new game not passed to the searcher:", s.options, s.newGames)
+	}
+}
+
+func TestPositionAndGo(t *testing.T) {
+	s := &fakeSearcher{options: map[string]string{}}
+	lines := runEngine(t, s, `position startpos moves e2e4 e7e5 g1f3
+go wtime 60000 btime 50000 winc 1000 binc 1000 depth 7
+position fen 4k3/8/8/8/8/8/4P3/4K3 w - - 0 1 moves e2e4
+go nodes 5000 searchmoves e8d8 e8f7
+position fen 4k3/8/8/8/8/8/8/4K3 w - - 0 1 moves e1e3
+go infinite
+stop
+`)
+	if len(s.fens) != 3 {
+		t.Fatal("Expected three searches, got", len(s.fens))
+	}
+	expectedFens := []string{
+		"rnbqkbnr/pppp1ppp/8/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R b KQkq - 1 2",
+		"4k3/8/8/8/4P3/8/8/4K3 b - e3 0 1",
+		"4k3/8/8/8/8/8/8/4K3 w - - 0 1",
+	}
+	for i, fen := range expectedFens {
+		if s.fens[i] != fen {
+			t.Error("Wrong position searched:", s.fens[i])
+		}
+	}
+	l := s.limits[0]
+	if l.WTime != time.Minute || l.BTime != 50*time.Second || l.WInc != time.Second || l.Depth != 7 {
+		t.Error("Wrong limits:", l)
+	}
+	if s.limits[1].Nodes != 5000 || len(s.limits[1].SearchMoves) != 2 || !s.limits[2].Infinite {
+		t.Error("Wrong limits:", s.limits[1], s.limits[2])
+	}
+	expectedLines := []string{
+		"info depth 1 score cp 25 nodes 20 pv a7a6 string fake",
+		"bestmove a7a6",
+		"info depth 1 score cp 25 nodes 20 pv e8d7 string fake",
+		"bestmove e8d7",
+		"info string Illegal move: e1e3",
+		"info depth 1 score cp 25 nodes 20 pv e1d1 string fake",
+		"bestmove e1d1",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expectedLines, "\n") {
+		t.Error("Wrong output:\n" + strings.Join(lines, "\n"))
+	}
+}
+
+func TestMoveTime(t *testing.T) {
+	s := &fakeSearcher{options: map[string]string{}}
+	in, inWriter := io.Pipe()
+	outReader, out := io.Pipe()
+	go NewEngine("Test", "Tester", s).Run(in, out)
+	start := time.Now()
+	io.WriteString(inWriter, "position startpos\ngo movetime 50\n")
+	scanner := bufio.NewScanner(outReader)
+	for scanner.Scan() && !strings.HasPrefix(scanner.Text(), "bestmove") {
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > 5*time.Second {
+		t.Error("The search was not stopped on time:", elapsed)
+	}
+	if scanner.Text() != "bestmove a2a3" {
+		t.Error("Wrong output:", scanner.Text())
+	}
+	inWriter.Close()
+
+	budgets := []struct {
+		limits   Limits
+		white    bool
+		expected time.Duration
+	}{
+		{Limits{WTime: 30 * time.Second, BTime: time.Second}, true, time.Second},
+		{Limits{WTime: 30 * time.Second, BTime: 10 * time.Second, BInc: time.Second, MovesToGo: 10}, false, 1750 * time.Millisecond},
+		{Limits{WTime: 30 * time.Millisecond}, true, time.Millisecond},
+		{Limits{WTime: 30 * time.Second, Infinite: true}, true, 0},
+		{Limits{Depth: 5}, true, 0},
+	}
+	for _, b := range budgets {
+		if budget := b.limits.timeBudget(b.white); budget != b.expected {
+			t.Error("Expected a budget of", b.expected, "but got", budget, "for", b.limits)
+		}
+	}
+}
+
+func TestPerft(t *testing.T) {
+	s := &fakeSearcher{options: map[string]string{}}
+	lines := runEngine(t, s, "position fen r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1\ngo perft 2\n")
+	if len(lines) != 50 || lines[len(lines)-1] != "Nodes searched: 2039" {
+		t.Error("Wrong perft output:", lines)
+	}
+}
+
+func TestChess960Position(t *testing.T) {
+	s := &fakeSearcher{options: map[string]string{}}
+	runEngine(t, s, `setoption name UCI_Chess960 value true
+position fen bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9 moves f1f2 a7a6 g1h1
+go depth 1
+`)
+	if len(s.fens) != 1 || s.fens[0] != "bqnb1rkr/1p3ppp/p2ppn2/2p5/5P2/P2P4/NPP1PRPP/BQ1BNRK1 b kq - 1 10" {
+		t.Error("Wrong position after Chess960 castling:", s.fens)
+	}
+}
@@ -0,0 +1,149 @@
+// Package uci implements the Universal Chess Interface protocol, so that a chess
+// engine built on dragontoothmg can be used with GUIs and tournament managers.
+// The protocol loop is provided by Engine; the search itself is supplied by the
+// caller as a Searcher.
+package uci
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/dylhunn/dragontoothmg"
+)
+
+// A pluggable search algorithm, driven by an Engine.
+type Searcher interface {
+	// Called when the GUI announces a new game ("ucinewgame"), e.g. to clear hash tables.
+	NewGame()
+	// Options supported by the searcher, advertised in response to "uci".
+	Options() []Option
+	// Sets an option advertised by Options. Returns an error if the name or value is invalid.
+	SetOption(name, value string) error
+	// Searches the current position of the game and returns the best move.
+	// The search should stop promptly once stop is closed, which the Engine does when the
+	// GUI sends "stop" or the time allotted by limits runs out. Limits other than time
+	// (such as Depth and Nodes) are left to the searcher, as is continuing until stop
+	// when Infinite or Ponder is set. Progress may be reported with info, which is safe
+	// to call from any goroutine. The game must be left as it was found.
+	Search(game *dragontoothmg.Game, limits Limits, stop <-chan struct{}, info func(Info)) dragontoothmg.Move
+}
+
+// Limits on a search, from the arguments of the "go" command.
+// Zero values mean that there is no limit of that kind.
+type Limits struct {
+	Depth       int
+	Nodes       int64
+	Mate        int
+	MoveTime    time.Duration
+	WTime       time.Duration
+	BTime       time.Duration
+	WInc        time.Duration
+	BInc        time.Duration
+	MovesToGo   int
+	Infinite    bool
+	Ponder      bool
+	SearchMoves []dragontoothmg.Move // restrict the search to these moves, if not empty
+}
+
+// Progress of a search, reported to the GUI as an "info" line.
+// Zero values are omitted.
+type Info struct {
+	Depth    int
+	SelDepth int
+	Score    int // in centipawns, from the point of view of the side to move
+	Mate     int // if nonzero, the side to move mates in this many moves (negative if it is mated)
+	Nodes    int64
+	Time     time.Duration
+	PV       []dragontoothmg.Move
+	Message  string // free-form text, sent as "info string"
+}
+
+// An engine option, advertised in response to "uci" and changed with "setoption".
+type Option struct {
+	Name    string
+	Type    string // check, spin, combo, button or string
+	Default string
+	Min     int      // for spin options
+	Max     int      // for spin options
+	Vars    []string // for combo options
+}
+
+func (o Option) String() string {
+	str := "option name " + o.Name + " type " + o.Type
+	if o.Type != "button" {
+		str += " default " + o.Default
+	}
+	if o.Type == "spin" {
+		str += " min " + strconv.Itoa(o.Min) + " max " + strconv.Itoa(o.Max)
+	}
+	for _, v := range o.Vars {
+		str += " var " + v
+	}
+	return str
+}
+
+func (info Info) String() string {
+	str := "info"
+	if info.Depth > 0 {
+		str += " depth " + strconv.Itoa(info.Depth)
+	}
+	if info.SelDepth > 0 {
+		str += " seldepth " + strconv.Itoa(info.SelDepth)
+	}
+	if info.Mate != 0 {
+		str += " score mate " + strconv.Itoa(info.Mate)
+	} else if info.Depth > 0 || info.Score != 0 {
+		str += " score cp " + strconv.Itoa(info.Score)
+	}
+	if info.Nodes > 0 {
+		str += " nodes " + strconv.FormatInt(info.Nodes, 10)
+		if ms := int64(info.Time / time.Millisecond); ms > 0 {
+			str += " nps " + strconv.FormatInt(info.Nodes*1000/ms, 10)
+		}
+	}
+	if info.Time > 0 {
+		str += " time " + strconv.FormatInt(int64(info.Time/time.Millisecond), 10)
+	}
+	if len(info.PV) > 0 {
+		str += " pv"
+		for _, m := range info.PV {
+			str += " " + m.String()
+		}
+	}
+	if info.Message != "" {
+		str += " string " + info.Message
+	}
+	return str
+}
+
+// The time to spend on a move, given the clock; zero if there is no time limit.
+// Uses the whole move time if given, otherwise an even share of the remaining time
+// (assuming 30 moves to go if unknown) plus most of the increment.
+func (l Limits) timeBudget(white bool) time.Duration {
+	if l.Infinite || l.Ponder {
+		return 0
+	}
+	if l.MoveTime > 0 {
+		return l.MoveTime
+	}
+	remaining, inc := l.BTime, l.BInc
+	if white {
+		remaining, inc = l.WTime, l.WInc
+	}
+	if remaining <= 0 {
+		return 0
+	}
+	movesToGo := l.MovesToGo
+	if movesToGo <= 0 {
+		movesToGo = 30
+	}
+	budget := remaining/time.Duration(movesToGo) + inc*3/4
+	// Always keep a safety margin on the clock.
+	if limit := remaining - 50*time.Millisecond; budget > limit {
+		budget = limit
+	}
+	if budget < time.Millisecond {
+		budget = time.Millisecond
+	}
+	return budget
+}
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math"
+	"math/bits"
 	"strconv"
 	"strings"
 )
@@ -25,7 +27,7 @@ func recomputeBoardHash(b *Board) uint64 {
 	if b.blackCanCastleQueenside() {
 		hash ^= castleRightsZobristC[3]
 	}
-	hash ^= uint64(b.enpassant)
+	hash ^= enpassantZobrist(b.enpassant)
 	for i := uint8(0); i < 64; i++ {
 		if b.isWhitePieceAt(i) {
 			whitePiece, _ := determinePieceType(b, &(b.White), uint64(1)<<i, i)
@@ -66,6 +68,8 @@ func (b *Bitboards) sanityCheck() {
 
 // Some example valid move strings:
 // e1e2 b4d6 e7e8q a2a1n
+// Breaking change: the move has no flags, so it is not == to the same move from the
+// move generator; compare with Move.Base, or use Board.FlagMove (see Move).
 // TODO(dylhunn): Make the parser more forgiving. Eg: 0-0, O-O-O, a2-a3, D3D4
 func ParseMove(movestr string) (Move, error) {
 	if movestr == "0000" {
@@ -216,19 +220,19 @@ func (b *Board) ToFen() string {
 	position += " "
 	castleCount := 0
 	if b.whiteCanCastleKingside() {
-		position += "K"
+		position += b.castlingRightChar(true, true)
 		castleCount++
 	}
 	if b.whiteCanCastleQueenside() {
-		position += "Q"
+		position += b.castlingRightChar(true, false)
 		castleCount++
 	}
 	if b.blackCanCastleKingside() {
-		position += "k"
+		position += b.castlingRightChar(false, true)
 		castleCount++
 	}
 	if b.blackCanCastleQueenside() {
-		position += "q"
+		position += b.castlingRightChar(false, false)
 		castleCount++
 	}
 	if castleCount == 0 {
@@ -245,8 +249,10 @@ func (b *Board) ToFen() string {
 }
 
 // Parse a board from a FEN string.
+// For untrusted input, use ParseFenStrict instead.
 func ParseFen(fen string) Board {
 	// BUG(dylhunn): This FEN parsing implementation doesn't handle malformed inputs.
+	// ParseFenStrict validates its input and returns an error instead.
 	tokens := strings.Fields(fen)
 	var b Board
 	// replace digits with the appropriate number of dashes
@@ -300,17 +306,9 @@ func ParseFen(fen string) Board {
 	//b.Black.All = b.Black.Pawns | b.Black.Knights | b.Black.Bishops | b.Black.Rooks | b.Black.Queens | b.Black.Kings
 
 	b.Wtomove = tokens[1] == "w" || tokens[1] == "W"
-	if strings.Contains(tokens[2], "K") {
-		b.flipWhiteKingsideCastle()
-	}
-	if strings.Contains(tokens[2], "Q") {
-		b.flipWhiteQueensideCastle()
-	}
-	if strings.Contains(tokens[2], "k") {
-		b.flipBlackKingsideCastle()
-	}
-	if strings.Contains(tokens[2], "q") {
-		b.flipBlackQueensideCastle()
+	b.castleRooks = standardCastleRooks
+	for _, c := range tokens[2] {
+		b.parseCastlingRight(c)
 	}
 	if tokens[3] != "-" {
 		res, err := AlgebraicToIndex(tokens[3])
@@ -333,3 +331,257 @@ func ParseFen(fen string) Board {
 	b.hash = recomputeBoardHash(&b)
 	return b
 }
+
+// Adds a castling right from a FEN castling field character. Accepts the standard KQkq,
+// where K and Q refer to the outermost rook on that side of the king (as in X-FEN), and
+// the Shredder-FEN rook files A-H and a-h. A king or rook off its standard square marks the
+// board as Chess960; file letters naming the standard rooks, as in "HAha", do not, so that
+// ToFen gives back the same board.
+func (b *Board) parseCastlingRight(c rune) {
+	white := c >= 'A' && c <= 'Z'
+	lower := c | 0x20
+	var backRank uint8
+	var ourRooks, ourKings uint64
+	if white {
+		ourRooks, ourKings = b.White.Rooks, b.White.Kings
+	} else {
+		backRank = 56
+		ourRooks, ourKings = b.Black.Rooks, b.Black.Kings
+	}
+	kingFile := uint8(4)
+	if ourKings&onlyRank[backRank/8] != 0 {
+		kingFile = uint8(bits.TrailingZeros64(ourKings&onlyRank[backRank/8])) % 8
+	}
+	var rookFile uint8
+	var kingside bool
+	switch {
+	case lower == 'k':
+		kingside, rookFile = true, 7
+		for f := uint8(7); f > kingFile; f-- {
+			if bitSet(ourRooks, backRank+f) {
+				rookFile = f
+				break
+			}
+		}
+	case lower == 'q':
+		kingside, rookFile = false, 0
+		for f := uint8(0); f < kingFile; f++ {
+			if bitSet(ourRooks, backRank+f) {
+				rookFile = f
+				break
+			}
+		}
+	case lower >= 'a' && lower <= 'h':
+		rookFile = uint8(lower - 'a')
+		kingside = rookFile > kingFile
+	default:
+		return
+	}
+	idx := castleIndex(white, kingside)
+	b.castlerights |= 1 << idx
+	b.castleRooks[idx] = backRank + rookFile
+	if kingFile != 4 || b.castleRooks[idx] != standardCastleRooks[idx] {
+		b.Chess960 = true
+	}
+}
+
+// Returns the FEN character for a castling right. Chess960 rights use the rook file
+// when the rook is not the outermost one on its side of the king.
+func (b *Board) castlingRightChar(white bool, kingside bool) string {
+	rookSq := b.castleRookSquare(white, kingside)
+	var ourRooks uint64
+	letter, file := "q", "abcdefgh"[rookSq%8:rookSq%8+1]
+	if kingside {
+		letter = "k"
+	}
+	if white {
+		ourRooks = b.White.Rooks
+		letter, file = strings.ToUpper(letter), strings.ToUpper(file)
+	} else {
+		ourRooks = b.Black.Rooks
+	}
+	if !b.Chess960 {
+		return letter
+	}
+	rank := onlyRank[rookSq/8]
+	var outside uint64 // the squares between the rook and the edge of the board
+	if kingside {
+		outside = rank &^ ((uint64(1) << (rookSq + 1)) - 1)
+	} else {
+		outside = rank & ((uint64(1) << rookSq) - 1)
+	}
+	if ourRooks&outside != 0 {
+		return file
+	}
+	return letter
+}
+
+// Parse a board from a FEN string, returning an error if the FEN is malformed or
+// describes an impossible position. In addition to the syntax of each field, this
+// checks that each side has exactly one king, that no pawns are on the first or last
+// rank, that the side not to move is not in check, that castling rights match the
+// king and rook placement, and that the en passant square follows a double push.
+// The halfmove clock and fullmove number are optional, and default to 0 and 1.
+// Castling rights for a king or rook off its standard square give a Chess960 board;
+// use ParseFenStandard to reject those instead.
+func ParseFenStrict(fen string) (Board, error) {
+	var b Board
+	tokens := strings.Fields(fen)
+	if len(tokens) < 4 || len(tokens) > 6 {
+		return b, fmt.Errorf("Invalid FEN %q: expected 4 to 6 fields, found %d", fen, len(tokens))
+	}
+
+	// Piece placement: eight ranks of eight squares each
+	ranks := strings.Split(tokens[0], "/")
+	if len(ranks) != 8 {
+		return b, fmt.Errorf("Invalid FEN %q: expected 8 ranks, found %d", fen, len(ranks))
+	}
+	for i, rank := range ranks {
+		squares := 0
+		for _, c := range rank {
+			switch {
+			case c >= '1' && c <= '8':
+				squares += int(c - '0')
+			case strings.ContainsRune("pnbrqkPNBRQK", c):
+				squares++
+			default:
+				return b, fmt.Errorf("Invalid FEN %q: unexpected character %q in rank %d", fen, c, 8-i)
+			}
+		}
+		if squares != 8 {
+			return b, fmt.Errorf("Invalid FEN %q: rank %d has %d squares", fen, 8-i, squares)
+		}
+	}
+
+	if tokens[1] != "w" && tokens[1] != "b" {
+		return b, fmt.Errorf("Invalid FEN %q: side to move must be w or b, not %q", fen, tokens[1])
+	}
+
+	if tokens[2] != "-" {
+		for i, c := range tokens[2] {
+			if !strings.ContainsRune("KQkqABCDEFGHabcdefgh", c) || strings.ContainsRune(tokens[2][:i], c) {
+				return b, fmt.Errorf("Invalid FEN %q: malformed castling rights %q", fen, tokens[2])
+			}
+		}
+	}
+
+	if tokens[3] != "-" {
+		if len(tokens[3]) != 2 {
+			return b, fmt.Errorf("Invalid FEN %q: malformed en passant square %q", fen, tokens[3])
+		}
+		if _, err := AlgebraicToIndex(tokens[3]); err != nil {
+			return b, fmt.Errorf("Invalid FEN %q: malformed en passant square %q", fen, tokens[3])
+		}
+		// ParseFen stores a1 as no en passant square, so check the rank here.
+		if tokens[3][1] != '3' && tokens[3][1] != '6' {
+			return b, fmt.Errorf("Invalid FEN %q: en passant square %q is not on the third or sixth rank", fen, tokens[3])
+		}
+	}
+
+	clocks := []string{"0", "1"}
+	copy(clocks, tokens[4:])
+	halfmove, err := strconv.Atoi(clocks[0])
+	if err != nil || halfmove < 0 || halfmove > math.MaxUint8 {
+		return b, fmt.Errorf("Invalid FEN %q: halfmove clock %q is not in the range 0-%d", fen, clocks[0], math.MaxUint8)
+	}
+	fullmove, err := strconv.Atoi(clocks[1])
+	if err != nil || fullmove < 1 || fullmove > math.MaxUint16 {
+		return b, fmt.Errorf("Invalid FEN %q: fullmove number %q is not in the range 1-%d", fen, clocks[1], math.MaxUint16)
+	}
+
+	// The syntax is valid, so the lenient parser can build the board.
+	b = ParseFen(strings.Join(tokens[:4], " ") + " " + clocks[0] + " " + clocks[1])
+	if tokens[2] != "-" && bits.OnesCount8(b.castlerights) != len(tokens[2]) {
+		var blank Board
+		return blank, fmt.Errorf("Invalid FEN %q: castling rights %q name the same right twice", fen, tokens[2])
+	}
+	if err := b.validatePosition(); err != nil {
+		var blank Board
+		return blank, fmt.Errorf("Invalid FEN %q: %v", fen, err)
+	}
+	return b, nil
+}
+
+// Parse a board from a FEN string like ParseFenStrict, but only accept standard chess.
+// ParseFenStrict treats castling rights for a king or rook off its standard square as
+// Chess960 rights (as X-FEN and Shredder-FEN do), so a king on d1 with "K" parses as a
+// Chess960 board; here it is an error. Use this for input that cannot be Chess960.
+func ParseFenStandard(fen string) (Board, error) {
+	b, err := ParseFenStrict(fen)
+	if err != nil {
+		return b, err
+	}
+	if b.Chess960 {
+		var blank Board
+		return blank, fmt.Errorf("Invalid FEN %q: castling rights %q do not match the standard king and rook squares",
+			fen, strings.Fields(fen)[2])
+	}
+	return b, nil
+}
+
+// Checks that a syntactically valid board describes a plausible position.
+func (b *Board) validatePosition() error {
+	if bits.OnesCount64(b.White.Kings) != 1 || bits.OnesCount64(b.Black.Kings) != 1 {
+		return errors.New("each side must have exactly one king")
+	}
+	if (b.White.Pawns|b.Black.Pawns)&(onlyRank[0]|onlyRank[7]) != 0 {
+		return errors.New("pawns cannot be on the first or last rank")
+	}
+	// The side that just moved cannot have left its king in check.
+	var oppKing uint8
+	if b.Wtomove {
+		oppKing = uint8(bits.TrailingZeros64(b.Black.Kings))
+	} else {
+		oppKing = uint8(bits.TrailingZeros64(b.White.Kings))
+	}
+	if b.UnderDirectAttack(!b.Wtomove, oppKing) {
+		return errors.New("the side not to move is in check")
+	}
+
+	// Castling rights require the king on the back rank, with the castling rook on the
+	// correct side of it. Outside Chess960, they must both be on their original squares.
+	castleChecks := []struct {
+		white, kingside bool
+		kings, rooks    uint64
+		backRank        uint64
+		name            string
+	}{
+		{true, true, b.White.Kings, b.White.Rooks, onlyRank[0], "K"},
+		{true, false, b.White.Kings, b.White.Rooks, onlyRank[0], "Q"},
+		{false, true, b.Black.Kings, b.Black.Rooks, onlyRank[7], "k"},
+		{false, false, b.Black.Kings, b.Black.Rooks, onlyRank[7], "q"},
+	}
+	for _, c := range castleChecks {
+		if b.castlerights&(1<<castleIndex(c.white, c.kingside)) == 0 {
+			continue
+		}
+		kingSq := uint8(bits.TrailingZeros64(c.kings))
+		rookSq := b.castleRookSquare(c.white, c.kingside)
+		ok := c.kings&c.backRank != 0 && bitSet(c.rooks, rookSq) && (rookSq > kingSq) == c.kingside
+		if !b.Chess960 {
+			ok = ok && kingSq%8 == 4 && rookSq == standardCastleRooks[castleIndex(c.white, c.kingside)]
+		}
+		if !ok {
+			return errors.New("castling right " + c.name + " does not match the king and rook placement")
+		}
+	}
+
+	// The en passant square must be directly behind an opponent pawn that just
+	// double-pushed, with both squares it passed over empty.
+	if b.enpassant != 0 {
+		var epRank, pawnSq, originSq uint8
+		var oppPawns uint64
+		if b.Wtomove {
+			epRank, pawnSq, originSq, oppPawns = 5, b.enpassant-8, b.enpassant+8, b.Black.Pawns
+		} else {
+			epRank, pawnSq, originSq, oppPawns = 2, b.enpassant+8, b.enpassant-8, b.White.Pawns
+		}
+		allPieces := b.White.All | b.Black.All
+		if b.enpassant/8 != epRank || !bitSet(oppPawns, pawnSq) ||
+			bitSet(allPieces, b.enpassant) || bitSet(allPieces, originSq) {
+			return errors.New("en passant square " + IndexToAlgebraic(Square(b.enpassant)) +
+				" does not follow a double pawn push")
+		}
+	}
+	return nil
+}
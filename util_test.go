@@ -132,3 +132,141 @@ func TestToFen(t *testing.T) {
 		}
 	}
 }
+
+func TestChess960Fen(t *testing.T) {
+	// Shredder-FEN rook files are written as X-FEN: KQkq unless the rook is not the outermost one.
+	fenTests := map[string]string{
+		"bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9": "bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w KQkq - 2 9",
+		"rk5r/1p6/8/8/8/8/8/RR4KR w Bh - 0 1":                               "rk5r/1p6/8/8/8/8/8/RR4KR w Bk - 0 1",
+		"1r2k1r1/8/8/8/8/8/8/1R2K1R1 w KQkq - 0 1":                          "1r2k1r1/8/8/8/8/8/8/1R2K1R1 w KQkq - 0 1",
+	}
+	for fen, expected := range fenTests {
+		b := parseFenAndValidate(t, fen)
+		if !b.Chess960 {
+			t.Error("Expected a Chess960 board for", fen)
+		}
+		if b.ToFen() != expected {
+			t.Error("Error serializing FEN.\nOutput:  ", b.ToFen(), "\nExpected:", expected)
+		}
+		if _, err := ParseFenStrict(fen); err != nil {
+			t.Error("Unexpected error:", err)
+		}
+	}
+	if b := ParseFen(Startpos); b.Chess960 {
+		t.Error("The standard starting position should not be a Chess960 board")
+	}
+	// Shredder-FEN letters for the standard rooks describe a standard board, which
+	// must survive a round trip through ToFen.
+	for _, fen := range []string{
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w HAha - 0 1",
+		"r3k2r/8/8/8/8/8/8/R3K2R w Ha - 0 1",
+		"bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9",
+	} {
+		b := parseFenAndValidate(t, fen)
+		reparsed := ParseFen(b.ToFen())
+		if b != reparsed {
+			t.Error("FEN round trip changed the board for", fen, "to", b.ToFen())
+		}
+	}
+	if b := ParseFen("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w HAha - 0 1"); b.Chess960 || b.ToFen() != Startpos {
+		t.Error("Shredder-FEN letters for the standard rooks should give a standard board")
+	}
+	b := ParseFen("r3k2r/8/8/8/8/8/8/R3K2R w HAha - 0 1")
+	if m, err := b.ParseSAN("O-O"); err != nil || m.String() != "e1g1" {
+		t.Error("Wrong castling move", m.String(), err)
+	}
+	invalid := []string{
+		"rk5r/1p6/8/8/8/8/8/RR4KR w Ch - 0 1",  // no rook on the c-file
+		"rk5r/1p6/8/8/8/8/8/RR4KR w HK - 0 1",  // the same right twice
+		"rk5r/1p6/8/8/8/8/8/RR4KR w Gh - 0 1",  // the king's file
+		"rk5r/1p6/8/8/8/8/6K1/RR5R w Bh - 0 1", // king off the back rank
+	}
+	for _, fen := range invalid {
+		if _, err := ParseFenStrict(fen); err == nil {
+			t.Error("Expected an error parsing", fen)
+		}
+	}
+}
+
+func TestParseFenStrict(t *testing.T) {
+	valid := []string{
+		Startpos,
+		"1Q2rk2/2p2p2/1n4b1/N7/2B1Pp2/2B4P/1QPP4/4K2R b K e3 4 30",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3",
+	}
+	for _, fen := range valid {
+		b, err := ParseFenStrict(fen)
+		if err != nil {
+			t.Error("Failed to parse valid FEN", fen, err)
+			continue
+		}
+		validateBoard(t, &b)
+		lenient := ParseFen(fen)
+		if b.ToFen() != lenient.ToFen() || b.Hash() != lenient.Hash() {
+			t.Error("Strict and lenient parsing disagree for", fen)
+		}
+	}
+	if b, _ := ParseFenStrict("4k3/8/8/8/8/8/8/4K3 b - -"); b.Halfmoveclock != 0 || b.Fullmoveno != 1 {
+		t.Error("Wrong default clocks")
+	}
+
+	invalid := []string{
+		"",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq",             // too few fields
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1 extra", // too many fields
+		"rnbqkbnr/pppppppp/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",         // 7 ranks
+		"rnbqkbnr/pppppppp/9/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",       // bad digit
+		"rnbqkbnr/ppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",        // short rank
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNRR w KQkq - 0 1",      // long rank
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNX w KQkq - 0 1",       // bad piece
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR x KQkq - 0 1",       // bad side to move
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KKkq - 0 1",       // duplicate castling right
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkx - 0 1",       // bad castling right
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq z9 0 1",      // bad en passant square
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq e6 0 1",      // no pawn pushed
+		"rnbqkbnr/pppp1ppp/8/4p3/8/8/PPPPPPPP/RNBQKBNR w KQkq e3 0 1",    // wrong rank
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq a1 0 1",      // en passant square on the first rank
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq e4 0 1",      // en passant square on the fourth rank
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - -1 1",      // negative clock
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 256 1",     // clock overflow
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 x",       // bad fullmove number
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 0",       // fullmove number zero
+		"rnbq1bnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQ - 0 1",         // missing king
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBKKBNR w kq - 0 1",         // two kings
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNP w kq - 0 1",         // pawn on first rank
+		"rnbqkbnr/ppppp1pp/8/7Q/8/8/PPPPPPPP/RNB1KBNR w KQkq - 0 1",      // side not to move in check
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPKPPP/RNBQ1BNR w KQkq - 0 1",       // king has moved
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBN1 w KQkq - 0 1",       // rook missing
+		"1nbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",       // black can't castle long
+	}
+	for _, fen := range invalid {
+		if _, err := ParseFenStrict(fen); err == nil {
+			t.Error("Expected an error parsing", fen)
+		}
+	}
+}
+
+func TestParseFenStandard(t *testing.T) {
+	for _, fen := range []string{
+		Startpos,
+		"r3k2r/8/8/8/8/8/8/R3K2R w HAha - 0 1", // Shredder-FEN letters for the standard rooks
+		"rnbkqbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBKQBNR w - - 0 1",
+	} {
+		if b, err := ParseFenStandard(fen); err != nil || b.Chess960 {
+			t.Error("Failed to parse standard FEN", fen, err)
+		}
+	}
+	for _, fen := range []string{
+		"rnbkqbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBKQBNR w K - 0 1", // king on d1
+		"1r2k1r1/8/8/8/8/8/8/1R2K1R1 w KQkq - 0 1",              // rooks off the corners
+		"rk5r/1p6/8/8/8/8/8/RR4KR w Bh - 0 1",
+	} {
+		if _, err := ParseFenStrict(fen); err != nil {
+			t.Error("Unexpected error:", err)
+		}
+		if _, err := ParseFenStandard(fen); err == nil {
+			t.Error("Expected an error parsing", fen)
+		}
+	}
+}